@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// The types below make up version 1 of the public API under /api/v1. Unlike
+// the exports, which are meant to be read by humans, the API gives raw
+// values and IDs. Fields may be added to the types, but existing fields must
+// not be renamed, removed or change meaning; do that in a new version.
+
+type apiCategory struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Abbr       string `json:"abbr"`
+	Class      string `json:"class"`
+	Goal       string `json:"goal"`
+	Definition string `json:"definition"`
+}
+
+type apiPlatform struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Abbr string `json:"abbr"`
+}
+
+type apiSpelunker struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// apiRun is a run. Score is the score for score categories and the time in
+// milliseconds for time categories. Level is 4*(world-1)+floor, so 1-1 is 1
+// and 5-4 is 20. Date and Superseded are Unix times; Superseded is 0 for
+// current runs. Rank is only given on leaderboards, where runs with equal
+// results share a rank; TieBreak then orders them by submission, from 1.
+type apiRun struct {
+	ID          int    `json:"id"`
+	Rank        int    `json:"rank,omitempty"`
+	TieBreak    int    `json:"tieBreak,omitempty"`
+	CategoryID  int    `json:"categoryId"`
+	RunnerID    int    `json:"runnerId"`
+	RunnerName  string `json:"runnerName"`
+	Score       int    `json:"score"`
+	Level       int    `json:"level"`
+	SpelunkerID int    `json:"spelunkerId"`
+	Platform    int    `json:"platform"`
+	Date        int64  `json:"date"`
+	Superseded  int64  `json:"superseded"`
+	VideoLink   string `json:"videoLink"`
+	Comment     string `json:"comment"`
+}
+
+// apiRunner is a runner. Steam64 IDs do not fit in the integers of
+// JavaScript, so the ID is given as a string, which is empty if unset.
+type apiRunner struct {
+	ID          int      `json:"id"`
+	Username    string   `json:"username"`
+	Country     string   `json:"country"`
+	SpelunkerID int      `json:"spelunkerId"`
+	Steam64     string   `json:"steam64"`
+	Psn         string   `json:"psn"`
+	Xbla        string   `json:"xbla"`
+	Twitch      string   `json:"twitch"`
+	YouTube     string   `json:"youtube"`
+	Runs        []apiRun `json:"runs"`
+}
+
+type apiLeaderboard struct {
+	Category apiCategory `json:"category"`
+	Page     int         `json:"page"`
+	PerPage  int         `json:"perPage"`
+	Total    int         `json:"total"`
+	Runs     []apiRun    `json:"runs"`
+}
+
+const (
+	apiDefaultPerPage = 50
+	apiMaxPerPage     = 200
+)
+
+func newAPICategory(cat category) apiCategory {
+	result := apiCategory{cat.ID, cat.Name, cat.Abbr, "", cat.Goal, cat.Definition}
+	for _, class := range readCategories() {
+		for _, c := range class.Categories {
+			if c.ID == cat.ID {
+				result.Class = class.Class
+			}
+		}
+	}
+	return result
+}
+
+func newAPIRun(r run) apiRun {
+	var superseded int64
+	if r.IsObsolete() {
+		superseded = r.Obsoleted.Unix()
+	}
+	return apiRun{r.ID, 0, 0, r.Category.ID, r.Runner.ID, r.Runner.Username,
+		r.Score, r.Level, r.Spelunker.ID, r.Platform.ID, r.Time.Unix(),
+		superseded, r.Link, r.Comment}
+}
+
+// writeAPIResponse writes a given value as JSON with a given status code.
+func writeAPIResponse(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Println("Could not write json: ", err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// The API is public, so browser based tools on other sites may use it.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// writeAPIError writes an error message as JSON with a given status code.
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIResponse(w, status, map[string]string{"error": message})
+}
+
+// getPageParameters reads the page (starting at 1) and number of entries per
+// page from the query string of a request, falling back to defaults.
+func getPageParameters(r *http.Request) (page int, perPage int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err = strconv.Atoi(r.URL.Query().Get("perPage"))
+	if err != nil || perPage < 1 {
+		perPage = apiDefaultPerPage
+	}
+	if perPage > apiMaxPerPage {
+		perPage = apiMaxPerPage
+	}
+	return
+}
+
+// apiCategoriesHandler handles GET requests to /api/v1/categories
+func apiCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	categories := []apiCategory{}
+	for _, cat := range getAllCategories() {
+		categories = append(categories, newAPICategory(cat))
+	}
+	writeAPIResponse(w, 200, categories)
+}
+
+// apiLeaderboardHandler handles GET requests to /api/v1/categories/[0-9]+/leaderboard,
+// taking the filters of parseRunFilter
+func apiLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, _ := strconv.Atoi(mux.Vars(r)["categoryID"])
+	cat, err := getCategoryByID(categoryID)
+	if err != nil {
+		writeAPIError(w, 404, "No such category.")
+		return
+	}
+	filter, err := parseRunFilter(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, 400, err.Error())
+		return
+	}
+	runs, err := getFilteredRuns(cat, filter, 0)
+	if err != nil {
+		log.Println("Could not get runs: ", err)
+		writeAPIError(w, 500, "Internal server error.")
+		return
+	}
+	page, perPage := getPageParameters(r)
+	leaderboard := apiLeaderboard{newAPICategory(cat), page, perPage, len(runs), []apiRun{}}
+	for i := (page - 1) * perPage; i < len(runs) && i < page*perPage; i++ {
+		entry := newAPIRun(runs[i])
+		entry.Rank = runs[i].RankInCategory
+		entry.TieBreak = runs[i].TieBreak
+		leaderboard.Runs = append(leaderboard.Runs, entry)
+	}
+	writeAPIResponse(w, 200, leaderboard)
+}
+
+// apiPlatformsHandler handles GET requests to /api/v1/platforms
+func apiPlatformsHandler(w http.ResponseWriter, r *http.Request) {
+	result := []apiPlatform{}
+	for _, p := range platforms {
+		result = append(result, apiPlatform{p.ID, p.Name, p.Abbr})
+	}
+	writeAPIResponse(w, 200, result)
+}
+
+// apiRunHandler handles GET requests to /api/v1/runs/[0-9]+
+func apiRunHandler(w http.ResponseWriter, r *http.Request) {
+	runID, _ := strconv.Atoi(mux.Vars(r)["runID"])
+	thisRun, err := getRunByID(runID)
+	// Flagged runs and runs awaiting approval are not public.
+	if err != nil || thisRun.Flag != "" || thisRun.Pending {
+		writeAPIError(w, 404, "No such run.")
+		return
+	}
+	writeAPIResponse(w, 200, newAPIRun(thisRun))
+}
+
+// apiRunnerHandler handles GET requests to /api/v1/runners/[0-9]+. The
+// runner's current runs are included.
+func apiRunnerHandler(w http.ResponseWriter, r *http.Request) {
+	runnerID, _ := strconv.Atoi(mux.Vars(r)["runnerID"])
+	thisRunner, err := getRunnerByID(runnerID)
+	if err != nil {
+		writeAPIError(w, 404, "No such runner.")
+		return
+	}
+	runs, err := getRunsByRunnerID(runnerID)
+	if err != nil {
+		log.Println("Could not get runs: ", err)
+		writeAPIError(w, 500, "Internal server error.")
+		return
+	}
+	var steam64 string
+	if thisRunner.Steam != 0 {
+		steam64 = strconv.Itoa(thisRunner.Steam)
+	}
+	result := apiRunner{thisRunner.ID, thisRunner.Username, thisRunner.Country,
+		thisRunner.Spelunker.ID, steam64, thisRunner.Psn, thisRunner.Xbla,
+		thisRunner.Twitch, thisRunner.YouTube, []apiRun{}}
+	for _, run := range runs {
+		if run.Flag == "" && !run.Pending && !run.IsObsolete() {
+			result.Runs = append(result.Runs, newAPIRun(run))
+		}
+	}
+	writeAPIResponse(w, 200, result)
+}
+
+// apiSpelunkersHandler handles GET requests to /api/v1/spelunkers
+func apiSpelunkersHandler(w http.ResponseWriter, r *http.Request) {
+	result := []apiSpelunker{}
+	for _, s := range spelunkers {
+		result = append(result, apiSpelunker{s.ID, s.Name})
+	}
+	writeAPIResponse(w, 200, result)
+}
+
+// apiWorldRecordsHandler handles GET requests to /api/v1/worldrecords
+func apiWorldRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	worldRecords, err := getAllWorldRecords()
+	if err != nil {
+		log.Println("Could not get world records: ", err)
+		writeAPIError(w, 500, "Internal server error.")
+		return
+	}
+	result := []apiRun{}
+	for _, record := range worldRecords {
+		entry := newAPIRun(record)
+		entry.Rank = record.RankInCategory
+		entry.TieBreak = record.TieBreak
+		result = append(result, entry)
+	}
+	writeAPIResponse(w, 200, result)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// The actions recorded in the audit log.
+const (
+	auditApprove       = "approve"
+	auditReject        = "reject"
+	auditFlag          = "flag"
+	auditUnflag        = "unflag"
+	auditDismissAppeal = "dismiss-appeal"
+	auditDeleteRun     = "delete-run"
+	auditPasswordReset = "password-reset"
+	auditSetRole       = "set-role"
+)
+
+// An auditAction is an action recorded in the audit log, along with a
+// description suitable for display.
+type auditAction struct {
+	Action      string
+	Description string
+}
+
+// auditActions lists all actions recorded in the audit log.
+var auditActions = []auditAction{
+	{auditApprove, "Approved run"},
+	{auditReject, "Rejected run"},
+	{auditFlag, "Flagged run"},
+	{auditUnflag, "Unflagged run"},
+	{auditDismissAppeal, "Dismissed appeal"},
+	{auditDeleteRun, "Deleted run"},
+	{auditPasswordReset, "Reset password"},
+	{auditSetRole, "Changed role"},
+}
+
+// An auditEntry records an action taken by a moderator, or an action that
+// can not be undone, such as the deletion of a run. Only the ID and username
+// of Actor and Runner are set. Entries about runs also have a RunID and a
+// Category; Runner is the runner of the run, or the runner whose account was
+// affected.
+type auditEntry struct {
+	ID       int
+	Actor    runner
+	Action   string
+	RunID    int
+	Runner   runner
+	Category category
+	Reason   string
+	Time     time.Time
+}
+
+// auditFilter restricts the entries returned by getAuditLog. Zero values
+// match everything.
+type auditFilter struct {
+	ActorID    int
+	CategoryID int
+	Action     string
+}
+
+// getAuditLog returns the latest `limit` entries of the audit log matching
+// a given filter, newest first.
+func getAuditLog(filter auditFilter, limit int) ([]auditEntry, error) {
+	return db.getAuditLog(filter, limit)
+}
+
+// logRunAction records that a given actor took a given action on a run. As
+// the action has already taken place, failing to record it is only logged.
+func logRunAction(actor runner, action string, r run, reason string) {
+	err := db.addAuditEntry(auditEntry{Actor: actor, Action: action,
+		RunID: r.ID, Runner: r.Runner, Category: r.Category, Reason: reason})
+	if err != nil {
+		log.Println("Could not write to audit log: ", err)
+	}
+}
+
+// logRunnerAction records that a given actor took a given action on the
+// account of a runner. The actor has ID 0 if nobody was logged in.
+func logRunnerAction(actor runner, action string, target runner, reason string) {
+	err := db.addAuditEntry(auditEntry{Actor: actor, Action: action,
+		Runner: target, Reason: reason})
+	if err != nil {
+		log.Println("Could not write to audit log: ", err)
+	}
+}
+
+// FormatAction describes the action of the entry.
+func (e *auditEntry) FormatAction() string {
+	for _, a := range auditActions {
+		if a.Action == e.Action {
+			return a.Description
+		}
+	}
+	return e.Action
+}
+
+// FormatTime formats the time of the entry.
+func (e *auditEntry) FormatTime() string {
+	return e.Time.Format("2006-01-02 15:04")
+}
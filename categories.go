@@ -56,6 +56,30 @@ func (cat *category) isMain() bool {
 	return false
 }
 
+// beats returns true iff a given result is strictly better than another
+// one in the category; that is, higher for score categories and lower
+// for time categories.
+func (cat *category) beats(result, otherResult int) bool {
+	if cat.Goal == "Score" {
+		return result > otherResult
+	}
+	return result < otherResult
+}
+
+// needsReview returns true iff runs in the category must be approved
+// by a moderator before they appear on the leaderboards.
+func (cat *category) needsReview() bool {
+	if config.ReviewAllRuns {
+		return true
+	}
+	for _, id := range config.ReviewedCategories {
+		if id == cat.ID {
+			return true
+		}
+	}
+	return false
+}
+
 // getMainCategories returns a slice of all non-main categories.
 func getChallengeCategories() []category {
 	return readCategories()[1].Categories
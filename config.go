@@ -3,7 +3,9 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"strings"
 )
 
 type configType struct {
@@ -15,7 +17,44 @@ type configType struct {
 	SMTPUsername  string `json:"smtpUsername"`
 	SMTPPassword  string `json:"smtpPassword"`
 	MailSender    string `json:"mailSender"`
-	Moderators    []int  `json:"moderatorIDs"`
+	// LegacyModerators are the IDs of the moderators from before roles
+	// were stored in the database. They are made moderators on the first
+	// start; see importLegacyModerators.
+	LegacyModerators []int `json:"moderatorIDs"`
+	// Runs submitted in the categories in ReviewedCategories only appear
+	// on the leaderboards once a moderator has approved them. If
+	// ReviewAllRuns is true, this applies to all categories.
+	ReviewedCategories []int `json:"reviewedCategoryIDs"`
+	ReviewAllRuns      bool  `json:"reviewAllRuns"`
+	// SessionKeys are the keys of the session cookies, newest first; see
+	// initializeCookieStore. Sessions last SessionHours, or RememberMeDays
+	// if the user asks to be remembered.
+	SessionKeys    []sessionKeyPair `json:"sessionKeys"`
+	SessionHours   int              `json:"sessionHours"`
+	RememberMeDays int              `json:"rememberMeDays"`
+	// SecureCookies should be true whenever the site is served over HTTPS.
+	// CookieSameSite is one of "lax" (the default), "strict" and "none".
+	SecureCookies  bool   `json:"secureCookies"`
+	CookieSameSite string `json:"cookieSameSite"`
+	// SiteURL is the address of the site, like "https://mosstier.com",
+	// used for links in mails.
+	SiteURL string `json:"siteURL"`
+	// BehindProxy should be true if the site is served through a reverse
+	// proxy which sets the X-Forwarded-For header.
+	BehindProxy bool `json:"behindProxy"`
+	// MetricsAddress is the address, like "127.0.0.1:9091", on which to
+	// serve metrics for Prometheus; see metrics.go. If empty, metrics are
+	// not served.
+	MetricsAddress string `json:"metricsAddress"`
+	// SteamOpenIDEndpoint can be set to test signing in through Steam
+	// against a stand-in for Steam; see steamopenid.go.
+	SteamOpenIDEndpoint string `json:"steamOpenIDEndpoint"`
+	// SteamLeaderboards configures where and how the Steam leaderboards
+	// are read; see steam.go.
+	SteamLeaderboards steamLeaderboardConfig `json:"steamLeaderboards"`
+	// Points configures the points formula used to rank runners and
+	// countries across categories; see points.go.
+	Points pointsConfig `json:"points"`
 }
 
 var config configType
@@ -30,5 +69,18 @@ func readConfig() (err error) {
 	if err != nil {
 		return errors.New("Could not read config file.")
 	}
+	if formula := config.Points.Formula; formula != "" && formula != pointsFormulaRank && formula != pointsFormulaRelative {
+		return errors.New("Unknown points formula " + formula + ".")
+	}
 	return
 }
+
+// siteURL returns the address of the site, without a trailing slash. Links
+// in mails must not be based on the Host header of requests, as anybody can
+// set that, so if no address is configured, we assume a local test setup.
+func siteURL() string {
+	if config.SiteURL == "" {
+		return fmt.Sprintf("http://localhost:%d", config.WebserverPort)
+	}
+	return strings.TrimSuffix(config.SiteURL, "/")
+}
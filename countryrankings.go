@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Countries are ranked by the current runs of their runners: a country's
+// runners are those with a country set who have runs on the leaderboards,
+// and the country earns the points of their runs; see points.go.
+
+// A countryStanding sums up the runs from a country.
+type countryStanding struct {
+	// Rank is the rank among all countries; it is 0 on national
+	// leaderboards.
+	Rank         int
+	Code         string
+	Runners      int
+	WorldRecords int
+	Points       int
+}
+
+// A countryRunner sums up the runs of a runner from a country.
+type countryRunner struct {
+	Runner       runner
+	Runs         int
+	WorldRecords int
+	Points       int
+}
+
+// A countryLeaderboard is the national leaderboard of a country.
+type countryLeaderboard struct {
+	Standing countryStanding
+	// BestRuns holds the best run from the country in each category in
+	// which it has runs, ranked among all runs in the category.
+	BestRuns []run
+	Runners  []countryRunner
+}
+
+var errNoSuchCountry = errors.New("No such country.")
+
+// FormatCountry returns the name of the country.
+func (c *countryStanding) FormatCountry() string {
+	return countries[c.Code]
+}
+
+// getCountryStandings returns the standings of all countries with runners,
+// ordered by points, then by world records held, and then by runners.
+func getCountryStandings() ([]countryStanding, error) {
+	allRuns, err := getCurrentRunsByCategory()
+	if err != nil {
+		return nil, err
+	}
+	standings := make(map[string]*countryStanding)
+	runners := make(map[string]map[int]bool)
+	for _, runs := range allRuns {
+		for _, r := range runs {
+			code := r.Runner.Country
+			if code == "" {
+				continue
+			}
+			if standings[code] == nil {
+				standings[code] = &countryStanding{Code: code}
+				runners[code] = make(map[int]bool)
+			}
+			runners[code][r.Runner.ID] = true
+			standings[code].Points += runPoints(r, runs[0])
+			if r.IsWorldRecord() {
+				standings[code].WorldRecords++
+			}
+		}
+	}
+	result := []countryStanding{}
+	for code, standing := range standings {
+		standing.Runners = len(runners[code])
+		result = append(result, *standing)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		if a.WorldRecords != b.WorldRecords {
+			return a.WorldRecords > b.WorldRecords
+		}
+		if a.Runners != b.Runners {
+			return a.Runners > b.Runners
+		}
+		return a.Code < b.Code
+	})
+	ranks := sharedRanks(len(result), func(i, j int) bool {
+		return result[i].Points == result[j].Points &&
+			result[i].WorldRecords == result[j].WorldRecords && result[i].Runners == result[j].Runners
+	})
+	for i := range result {
+		result[i].Rank = ranks[i]
+	}
+	return result, nil
+}
+
+// getCountryLeaderboard returns the national leaderboard of the country with
+// a given code, in any case.
+func getCountryLeaderboard(code string) (countryLeaderboard, error) {
+	code = strings.ToUpper(code)
+	if code == "" || countries[code] == "" {
+		return countryLeaderboard{}, errNoSuchCountry
+	}
+	allRuns, err := getCurrentRunsByCategory()
+	if err != nil {
+		return countryLeaderboard{}, err
+	}
+	leaderboard := countryLeaderboard{Standing: countryStanding{Code: code},
+		BestRuns: []run{}, Runners: []countryRunner{}}
+	runners := make(map[int]*countryRunner)
+	for _, runs := range allRuns {
+		foundBest := false
+		for _, r := range runs {
+			if r.Runner.Country != code {
+				continue
+			}
+			if !foundBest {
+				leaderboard.BestRuns = append(leaderboard.BestRuns, r)
+				foundBest = true
+			}
+			if runners[r.Runner.ID] == nil {
+				runners[r.Runner.ID] = &countryRunner{Runner: r.Runner}
+			}
+			points := runPoints(r, runs[0])
+			runners[r.Runner.ID].Runs++
+			runners[r.Runner.ID].Points += points
+			leaderboard.Standing.Points += points
+			if r.IsWorldRecord() {
+				runners[r.Runner.ID].WorldRecords++
+				leaderboard.Standing.WorldRecords++
+			}
+		}
+	}
+	for _, runner := range runners {
+		leaderboard.Runners = append(leaderboard.Runners, *runner)
+	}
+	sort.Slice(leaderboard.Runners, func(i, j int) bool {
+		a, b := leaderboard.Runners[i], leaderboard.Runners[j]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		return strings.ToLower(a.Runner.Username) < strings.ToLower(b.Runner.Username)
+	})
+	leaderboard.Standing.Runners = len(leaderboard.Runners)
+	return leaderboard, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetCountryStandings(t *testing.T) {
+	addRankingRuns(t)
+	standings, err := getCountryStandings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Runners without a country do not count.
+	want := []countryStanding{
+		{1, "DK", 2, 2, 30},
+		{2, "SE", 1, 1, 18},
+	}
+	if !reflect.DeepEqual(standings, want) {
+		t.Errorf("got %+v, want %+v", standings, want)
+	}
+}
+
+func TestGetCountryLeaderboard(t *testing.T) {
+	_, ana, bob, _, _ := addRankingRuns(t)
+	leaderboard, err := getCountryLeaderboard("dk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (countryStanding{0, "DK", 2, 2, 30}); leaderboard.Standing != want {
+		t.Errorf("got standing %+v, want %+v", leaderboard.Standing, want)
+	}
+	// The best runs keep their ranks among all runs in their categories.
+	type best struct{ runnerID, categoryID, rank, tieBreak int }
+	var gotBest []best
+	for _, r := range leaderboard.BestRuns {
+		gotBest = append(gotBest, best{r.Runner.ID, r.Category.ID, r.RankInCategory, r.TieBreak})
+	}
+	score, _ := getCategoryByAbbr("score")
+	wantBest := []best{
+		{ana.ID, score.ID, 1, 1},
+		{ana.ID, getChallengeCategories()[0].ID, 1, 0},
+	}
+	if !reflect.DeepEqual(gotBest, wantBest) {
+		t.Errorf("got best runs %v, want %v", gotBest, wantBest)
+	}
+	type ranked struct{ runnerID, runs, worldRecords, points int }
+	var gotRunners []ranked
+	for _, r := range leaderboard.Runners {
+		gotRunners = append(gotRunners, ranked{r.Runner.ID, r.Runs, r.WorldRecords, r.Points})
+	}
+	wantRunners := []ranked{{ana.ID, 2, 2, 20}, {bob.ID, 1, 0, 10}}
+	if !reflect.DeepEqual(gotRunners, wantRunners) {
+		t.Errorf("got runners %v, want %v", gotRunners, wantRunners)
+	}
+
+	leaderboard, err = getCountryLeaderboard("NO")
+	if err != nil || len(leaderboard.Runners) != 0 || len(leaderboard.BestRuns) != 0 {
+		t.Errorf("got %+v, %v for a country without runners", leaderboard, err)
+	}
+	for _, code := range []string{"", "XX"} {
+		_, err = getCountryLeaderboard(code)
+		if err != errNoSuchCountry {
+			t.Errorf("got %v for %q, want errNoSuchCountry", err, code)
+		}
+	}
+}
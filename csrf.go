@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// To keep other sites from posting forms on behalf of our users, every form
+// contains a token that is also stored in the session cookie, which other
+// sites can not read. Forms send the token in the csrfToken field, and
+// JavaScript sends it in the X-CSRF-Token header; see js/csrf.js.
+const (
+	csrfFieldName  = "csrfToken"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+var errInvalidCSRFToken = errors.New("The form has expired. Please reload the page and try again.")
+
+// getCSRFToken returns the token of the session of a request, creating the
+// token if there is none. As this may set a cookie, it must be called before
+// anything is written to the response.
+func getCSRFToken(r *http.Request, w http.ResponseWriter) string {
+	session, _ := cookieStore.Get(r, "login")
+	if token, ok := session.Values["csrfToken"].(string); ok && token != "" {
+		return token
+	}
+	token, err := randomToken()
+	if err != nil {
+		log.Println("Could not generate CSRF token: ", err)
+		return ""
+	}
+	session.Values["csrfToken"] = token
+	err = session.Save(r, w)
+	if err != nil {
+		log.Println("Could not save CSRF token: ", err)
+	}
+	return token
+}
+
+// checkCSRFToken returns an error unless a request contains the token of its
+// session, either in a form field or in a header. The form must be parsed.
+func checkCSRFToken(r *http.Request) error {
+	session, err := cookieStore.Get(r, "login")
+	if err != nil {
+		return errInvalidCSRFToken
+	}
+	expected, ok := session.Values["csrfToken"].(string)
+	if !ok || expected == "" {
+		return errInvalidCSRFToken
+	}
+	given := r.PostFormValue(csrfFieldName)
+	if given == "" {
+		given = r.Header.Get(csrfHeaderName)
+	}
+	if subtle.ConstantTimeCompare([]byte(given), []byte(expected)) != 1 {
+		return errInvalidCSRFToken
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// The daily challenge leaderboards live on Steam only, so we mirror them: a
+// background job regularly reads the leaderboards of today and yesterday,
+// the latter to get its final standings. Entries are matched to runners by
+// their linked Steam accounts when they are shown, so runners also find
+// their old dailies once they link their accounts.
+
+// dailyDateFormat is the format of dates in the database and in addresses.
+const dailyDateFormat = "2006-01-02"
+
+// A daily is the leaderboard of a single day.
+type daily struct {
+	Date time.Time
+	// EntryCount is the number of runners who played the daily.
+	EntryCount int
+}
+
+// A dailyEntry is a single entry on a daily challenge leaderboard.
+type dailyEntry struct {
+	Date time.Time
+	Rank int
+	// Total is the number of entries on the leaderboard.
+	Total int
+	Steam int
+	// Runner is the runner who has linked Steam; its ID is 0 if none has.
+	Runner    runner
+	Score     int
+	Level     int
+	Spelunker spelunker
+}
+
+// FormatDate formats the date of the daily.
+func (d *daily) FormatDate() string {
+	return d.Date.Format(dailyDateFormat)
+}
+
+// FormatDate formats the date of the daily of the entry.
+func (e *dailyEntry) FormatDate() string {
+	return e.Date.Format(dailyDateFormat)
+}
+
+// FormatScore formats the gold collected in the daily.
+func (e *dailyEntry) FormatScore() string {
+	return fmt.Sprintf("$%d", e.Score)
+}
+
+// FormatLevel formats the level at which the daily ended.
+func (e *dailyEntry) FormatLevel() string {
+	return fmt.Sprintf("%d-%d", (e.Level-1)/4+1, (e.Level-1)%4+1)
+}
+
+// parseDailyDate reads a date in dailyDateFormat.
+func parseDailyDate(date string) (time.Time, error) {
+	return time.Parse(dailyDateFormat, date)
+}
+
+// getDailies returns the latest `limit` dailies mirrored, newest first.
+func getDailies(limit int) ([]daily, error) {
+	return db.getDailies(limit)
+}
+
+// getDailyEntries returns a page of the leaderboard of the daily of a given
+// day, along with the number of entries in total.
+func getDailyEntries(day time.Time, offset, limit int) ([]dailyEntry, int, error) {
+	return db.getDailyEntries(day.Format(dailyDateFormat), offset, limit)
+}
+
+// getDailyEntriesByRunner returns the latest `limit` daily entries of a
+// runner who has linked their Steam account.
+func getDailyEntriesByRunner(r runner, limit int) ([]dailyEntry, error) {
+	if !r.SteamVerified {
+		return []dailyEntry{}, nil
+	}
+	return db.getDailyEntriesBySteam(r.Steam, limit)
+}
+
+// mirrorDaily reads the daily challenge leaderboard of a given day from
+// Steam and stores it, replacing what was stored before.
+func mirrorDaily(day time.Time) error {
+	leaderboardID, steamEntries, err := steamLeaderboards.fetchDailyLeaderboard(day)
+	if err != nil {
+		return err
+	}
+	entries := []dailyEntry{}
+	seen := make(map[int]bool)
+	for _, steamEntry := range steamEntries {
+		steamID, err := strconv.Atoi(steamEntry.SteamID)
+		if err != nil || seen[steamID] {
+			continue
+		}
+		score, level, spelunkerID, err := steamEntry.parse()
+		if err != nil {
+			continue
+		}
+		seen[steamID] = true
+		rank, err := strconv.Atoi(steamEntry.Rank)
+		if err != nil {
+			rank = len(entries) + 1
+		}
+		entries = append(entries, dailyEntry{Rank: rank, Steam: steamID, Score: score,
+			Level: level, Spelunker: spelunker{ID: spelunkerID}})
+	}
+	return db.saveDaily(day.Format(dailyDateFormat), leaderboardID, entries)
+}
+
+// startDailyMirror starts the background job mirroring the dailies.
+func startDailyMirror() {
+	minutes := config.SteamLeaderboards.DailyFetchMinutes
+	if minutes < 0 {
+		return
+	}
+	if minutes == 0 {
+		minutes = defaultDailyFetchMinutes
+	}
+	go func() {
+		for {
+			today := time.Now().UTC().Truncate(24 * time.Hour)
+			for _, day := range []time.Time{today.AddDate(0, 0, -1), today} {
+				err := mirrorDaily(day)
+				if err != nil {
+					log.Printf("Could not mirror the daily of %s: %s", day.Format(dailyDateFormat), err)
+				}
+			}
+			time.Sleep(time.Duration(minutes) * time.Minute)
+		}
+	}()
+}
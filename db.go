@@ -1,13 +1,20 @@
 package main
 
-import (
-	"database/sql"
-	_ "github.com/go-sql-driver/mysql"
-)
+// db is where all runs and runners are stored; see store.go.
+var db store
 
-var db *sql.DB
+// openDatabase opens the store given in the config.
+func openDatabase() (err error) {
+	db, err = openStore(config.DbConnection)
+	return
+}
 
+// initializeDatabase opens the store and brings its schema up to date;
+// see migrations.go.
 func initializeDatabase() (err error) {
-	db, err = sql.Open("mysql", config.DbConnection)
-	return
+	err = openDatabase()
+	if err != nil {
+		return
+	}
+	return db.migrate()
 }
@@ -32,6 +32,10 @@ func parseDeleteRunRequest(r *http.Request) error {
 	if err != nil {
 		return errors.New("Could not parse request")
 	}
+	err = checkCSRFToken(r)
+	if err != nil {
+		return err
+	}
 	runIDstr, err := getFormValue(r, "runID")
 	if err != nil {
 		return errors.New("Could not parse run ID")
@@ -51,7 +55,7 @@ func parseDeleteRunRequest(r *http.Request) error {
 	if activeUser.ID != run.Runner.ID {
 		return errors.New("User is not the runner of the run")
 	}
-	err = run.deleteFromDatabase()
+	err = run.deleteFromDatabase(activeUser)
 	if err != nil {
 		return errors.New("Could not delete run")
 	}
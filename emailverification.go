@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// New and changed email addresses are unverified until the runner follows a
+// link mailed to the address. Until then, we send no notifications to the
+// address. The links work like password reset links; see passwordreset.go.
+const (
+	emailVerificationLifetime  = 7 * 24 * time.Hour
+	emailVerificationTokenName = "emailVerification"
+)
+
+// Runners can ask for new links, but not too often.
+var emailVerificationsByAccount = newRateLimiter(3, time.Hour)
+
+var (
+	errInvalidEmailVerificationLink = errors.New("This link is invalid or has expired. You can ask for a new one when editing your profile.")
+	errTooManyEmailVerifications    = errors.New("Too many links have been requested. Please try again later.")
+)
+
+// requestEmailVerification mails the runner a link that verifies their
+// current email address.
+func (r *runner) requestEmailVerification() error {
+	if r.Email == "" {
+		return errors.New("user has no email set")
+	}
+	id, err := randomToken()
+	if err != nil {
+		return err
+	}
+	token, err := encodeLinkToken(emailVerificationTokenName, id)
+	if err != nil {
+		return err
+	}
+	err = db.createEmailVerification(hashToken(id), r.ID, r.Email, time.Now().Add(emailVerificationLifetime))
+	if err != nil {
+		return err
+	}
+	err = db.deleteExpiredEmailVerifications()
+	if err != nil {
+		log.Println("Could not delete expired email verifications: ", err)
+	}
+	// The runner's address is unverified, so r.sendMail would refuse.
+	return sendMail(r.Email, "Verify your email address", "Hi "+r.Username+". To "+
+		"confirm that this is your email address on Moss Tier, follow the link below "+
+		"within the next week:\n\n"+siteURL()+"/verify-email/"+token+"\n\n"+
+		"If you do not have a user on Moss Tier, you can ignore this mail.")
+}
+
+// verifyEmail marks the email address in a given verification token as
+// verified, and returns the runner it belongs to. Links for addresses the
+// runner no longer uses are invalid.
+func verifyEmail(token string) (runner, error) {
+	id, err := decodeLinkToken(emailVerificationTokenName, token)
+	if err != nil {
+		return runner{}, errInvalidEmailVerificationLink
+	}
+	runnerID, email, expires, err := db.getEmailVerification(hashToken(id))
+	if err != nil || time.Now().After(expires) {
+		return runner{}, errInvalidEmailVerificationLink
+	}
+	user, err := getRunnerByID(runnerID)
+	if err != nil || user.Email != email {
+		return runner{}, errInvalidEmailVerificationLink
+	}
+	err = db.verifyEmail(user.ID, email)
+	if err != nil {
+		return runner{}, err
+	}
+	user.EmailVerified = true
+	err = db.deleteEmailVerifications(user.ID)
+	if err != nil {
+		log.Println("Could not delete email verifications: ", err)
+	}
+	return user, nil
+}
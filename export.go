@@ -40,9 +40,9 @@ func exportWrHandler(w http.ResponseWriter, r *http.Request) {
 		// Set up the data
 		w.Header().Set("Content-Type", "text/csv")
 		body := make([][]string, len(worldRecords)+1)
-		body[0] = []string{"Category", "Player", "Score/time", "Video link", "Comment"}
+		body[0] = []string{"Category", "Player", "Score/time", "Platform", "Video link", "Comment"}
 		for i, record := range worldRecords {
-			body[i+1] = []string{record.Category.Name, record.Runner.Username, record.FormatScore(), record.Link, record.Comment}
+			body[i+1] = []string{record.Category.Name, record.Runner.Username, record.FormatScore(), record.Platform.Name, record.Link, record.Comment}
 		}
 		// Output the data
 		wr := csv.NewWriter(w)
@@ -58,6 +58,7 @@ func exportWrHandler(w http.ResponseWriter, r *http.Request) {
 			Category  string `json:"category"`
 			Player    string `json:"player"`
 			Result    string `json:"result"`
+			Platform  string `json:"platform"`
 			Videolink string `json:"videoLink"`
 			Comment   string `json:"comment"`
 		}
@@ -70,6 +71,7 @@ func exportWrHandler(w http.ResponseWriter, r *http.Request) {
 				recordJson{record.Category.Name,
 					record.Runner.Username,
 					record.FormatScore(),
+					record.Platform.Name,
 					record.Link,
 					record.Comment})
 		}
@@ -86,6 +88,7 @@ func exportWrHandler(w http.ResponseWriter, r *http.Request) {
 			Category  string   `xml:"category,attr"`
 			Player    string   `xml:"player"`
 			Result    string   `xml:"result"`
+			Platform  string   `xml:"platform"`
 			VideoLink string   `xml:"videoLink"`
 			Comment   string   `xml:"comment"`
 		}
@@ -98,6 +101,7 @@ func exportWrHandler(w http.ResponseWriter, r *http.Request) {
 			newRecord := &recordXml{Category: record.Category.Name}
 			newRecord.Player = record.Runner.Username
 			newRecord.Result = record.FormatScore()
+			newRecord.Platform = record.Platform.Name
 			newRecord.VideoLink = record.Link
 			newRecord.Comment = record.Comment
 			wrs.Records = append(wrs.Records, *newRecord)
@@ -111,7 +115,8 @@ func exportWrHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// exportCategoryHandler handles requests to /export/[0-9]+/[a-z]+
+// exportCategoryHandler handles requests to /export/[0-9]+/[a-z]+, taking
+// the filters of parseRunFilter
 func exportCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	exportFormat := mux.Vars(r)["exportFormat"]
 	if !isLegitExportFormat(exportFormat) {
@@ -124,7 +129,13 @@ func exportCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	runs, err := getRunsByCategory(category, 0)
+	// Exports take the same filters as the leaderboards.
+	filter, err := parseRunFilter(r.URL.Query())
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	runs, err := getFilteredRuns(category, filter, 0)
 	if err != nil {
 		log.Println("Could not get runs: ", err)
 		http.Error(w, "Internal server error", 500)
@@ -134,9 +145,9 @@ func exportCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	case "csv":
 		w.Header().Set("Content-Type", "text/csv")
 		body := make([][]string, len(runs)+1)
-		body[0] = []string{"Rank", "Player", category.Goal, "Video link", "Comment"}
+		body[0] = []string{"Rank", "Tie-break", "Player", category.Goal, "Platform", "Video link", "Comment"}
 		for i, run := range runs {
-			body[i+1] = []string{strconv.Itoa(i + 1), run.Runner.Username, run.FormatScore(), run.Link, run.Comment}
+			body[i+1] = []string{strconv.Itoa(run.RankInCategory), run.FormatTieBreak(), run.Runner.Username, run.FormatScore(), run.Platform.Name, run.Link, run.Comment}
 		}
 		// Output the data
 		wr := csv.NewWriter(w)
@@ -150,8 +161,10 @@ func exportCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		type runJSON struct {
 			Rank      int    `json:"rank"`
+			TieBreak  int    `json:"tieBreak,omitempty"`
 			Player    string `json:"player"`
 			Result    string `json:"result"`
+			Platform  string `json:"platform"`
 			Videolink string `json:"videoLink"`
 			Comment   string `json:"comment"`
 		}
@@ -161,9 +174,9 @@ func exportCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		runsForExport := &runsJSON{}
 		runsForExport.Category = category.Name
-		for i, run := range runs {
+		for _, run := range runs {
 			runsForExport.Runs = append(runsForExport.Runs,
-				runJSON{i + 1, run.Runner.Username, run.FormatScore(), run.Link, run.Comment})
+				runJSON{run.RankInCategory, run.TieBreak, run.Runner.Username, run.FormatScore(), run.Platform.Name, run.Link, run.Comment})
 		}
 		body, err := json.Marshal(runsForExport)
 		if err != nil {
@@ -176,8 +189,10 @@ func exportCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		type runXML struct {
 			XMLName   xml.Name `xml:"run"`
 			Rank      int      `xml:"rank"`
+			TieBreak  int      `xml:"tieBreak,omitempty"`
 			Player    string   `xml:"player"`
 			Result    string   `xml:"result"`
+			Platform  string   `xml:"platform"`
 			VideoLink string   `xml:"videoLink"`
 			Comment   string   `xml:"comment"`
 		}
@@ -187,11 +202,13 @@ func exportCategoryHandler(w http.ResponseWriter, r *http.Request) {
 			Runs     []runXML `xml:"runs"`
 		}
 		runsForExport := &runsXML{Category: category.Name}
-		for i, run := range runs {
+		for _, run := range runs {
 			runForExport := &runXML{}
-			runForExport.Rank = i + 1
+			runForExport.Rank = run.RankInCategory
+			runForExport.TieBreak = run.TieBreak
 			runForExport.Player = run.Runner.Username
 			runForExport.Result = run.FormatScore()
+			runForExport.Platform = run.Platform.Name
 			runForExport.VideoLink = run.Link
 			runForExport.Comment = run.Comment
 			runsForExport.Runs = append(runsForExport.Runs, *runForExport)
@@ -205,3 +222,271 @@ func exportCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 }
+
+// exportHistoryHandler handles requests to /export/[0-9]+/history/json. The
+// results and dates are given as plain numbers to ease plotting.
+func exportHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, _ := strconv.Atoi(mux.Vars(r)["categoryID"])
+	category, err := getCategoryByID(categoryID)
+	if err != nil {
+		log.Println("Could not get category: ", err)
+		http.NotFound(w, r)
+		return
+	}
+	records, err := getWorldRecordHistory(category)
+	if err != nil {
+		log.Println("Could not get world record history: ", err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	type recordJSON struct {
+		Date            int64  `json:"date"`
+		Player          string `json:"player"`
+		Result          int    `json:"result"`
+		FormattedResult string `json:"formattedResult"`
+		Margin          int    `json:"margin"`
+		StandingSeconds int64  `json:"standingSeconds"`
+		Current         bool   `json:"current"`
+		VideoLink       string `json:"videoLink"`
+	}
+	type historyJSON struct {
+		Category string       `json:"category"`
+		Goal     string       `json:"goal"`
+		Records  []recordJSON `json:"records"`
+	}
+	history := &historyJSON{category.Name, category.Goal, []recordJSON{}}
+	for _, record := range records {
+		history.Records = append(history.Records,
+			recordJSON{record.Set.Unix(),
+				record.Run.Runner.Username,
+				record.Run.Score,
+				record.Run.FormatScore(),
+				record.Margin(),
+				int64(record.Standing().Seconds()),
+				record.IsCurrent(),
+				record.Run.Link})
+	}
+	body, err := json.Marshal(history)
+	if err != nil {
+		log.Println("Could not write json: ", err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// exportCountriesHandler handles requests to /export/countries/[a-z]+
+func exportCountriesHandler(w http.ResponseWriter, r *http.Request) {
+	exportFormat := mux.Vars(r)["exportFormat"]
+	if !isLegitExportFormat(exportFormat) {
+		http.NotFound(w, r)
+		return
+	}
+	standings, err := getCountryStandings()
+	if err != nil {
+		log.Println("Could not get country standings: ", err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	switch exportFormat {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		body := make([][]string, len(standings)+1)
+		body[0] = []string{"Rank", "Country", "Runners", "World records", "Points"}
+		for i, standing := range standings {
+			body[i+1] = []string{strconv.Itoa(standing.Rank), standing.FormatCountry(),
+				strconv.Itoa(standing.Runners), strconv.Itoa(standing.WorldRecords),
+				strconv.Itoa(standing.Points)}
+		}
+		wr := csv.NewWriter(w)
+		wr.Comma = ';'
+		err := wr.WriteAll(body)
+		if err != nil {
+			log.Println("Could not write csv: ", err)
+			http.Error(w, "Internal server error", 500)
+		}
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		type countryJSON struct {
+			Rank         int    `json:"rank"`
+			Code         string `json:"code"`
+			Country      string `json:"country"`
+			Runners      int    `json:"runners"`
+			WorldRecords int    `json:"worldRecords"`
+			Points       int    `json:"points"`
+		}
+		type countriesJSON struct {
+			Countries []countryJSON `json:"countries"`
+		}
+		result := &countriesJSON{[]countryJSON{}}
+		for _, standing := range standings {
+			result.Countries = append(result.Countries,
+				countryJSON{standing.Rank, standing.Code, standing.FormatCountry(),
+					standing.Runners, standing.WorldRecords, standing.Points})
+		}
+		body, err := json.Marshal(result)
+		if err != nil {
+			log.Println("Could not write json: ", err)
+			http.Error(w, "Internal server error", 500)
+			return
+		}
+		w.Write(body)
+	case "xml":
+		w.Header().Set("Content-Type", "text/xml")
+		type countryXML struct {
+			XMLName      xml.Name `xml:"country"`
+			Code         string   `xml:"code,attr"`
+			Rank         int      `xml:"rank"`
+			Country      string   `xml:"name"`
+			Runners      int      `xml:"runners"`
+			WorldRecords int      `xml:"worldRecords"`
+			Points       int      `xml:"points"`
+		}
+		type countriesXML struct {
+			XMLName   xml.Name     `xml:"countries"`
+			Countries []countryXML `xml:"country"`
+		}
+		result := &countriesXML{}
+		for _, standing := range standings {
+			result.Countries = append(result.Countries,
+				countryXML{Code: standing.Code, Rank: standing.Rank, Country: standing.FormatCountry(),
+					Runners: standing.Runners, WorldRecords: standing.WorldRecords, Points: standing.Points})
+		}
+		body, err := xml.Marshal(result)
+		if err != nil {
+			log.Println("Could not write xml: ", err)
+			http.Error(w, "Internal server error", 500)
+			return
+		}
+		w.Write(body)
+	}
+}
+
+// exportCountryHandler handles requests to /export/country/[a-zA-Z]{2}/[a-z]+.
+// As CSV has room for a single table only, CSV exports hold the best runs of
+// the country, but not its runners.
+func exportCountryHandler(w http.ResponseWriter, r *http.Request) {
+	exportFormat := mux.Vars(r)["exportFormat"]
+	if !isLegitExportFormat(exportFormat) {
+		http.NotFound(w, r)
+		return
+	}
+	leaderboard, err := getCountryLeaderboard(mux.Vars(r)["countryCode"])
+	if err == errNoSuchCountry {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Println("Could not get country leaderboard: ", err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	standing := leaderboard.Standing
+	switch exportFormat {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		body := make([][]string, len(leaderboard.BestRuns)+1)
+		body[0] = []string{"Category", "Rank", "Player", "Score/time", "Platform", "Video link", "Comment"}
+		for i, run := range leaderboard.BestRuns {
+			body[i+1] = []string{run.Category.Name, strconv.Itoa(run.RankInCategory), run.Runner.Username,
+				run.FormatScore(), run.Platform.Name, run.Link, run.Comment}
+		}
+		wr := csv.NewWriter(w)
+		wr.Comma = ';'
+		err := wr.WriteAll(body)
+		if err != nil {
+			log.Println("Could not write csv: ", err)
+			http.Error(w, "Internal server error", 500)
+		}
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		type runJSON struct {
+			Category  string `json:"category"`
+			Rank      int    `json:"rank"`
+			Player    string `json:"player"`
+			Result    string `json:"result"`
+			Platform  string `json:"platform"`
+			Videolink string `json:"videoLink"`
+			Comment   string `json:"comment"`
+		}
+		type runnerJSON struct {
+			Player       string `json:"player"`
+			Runs         int    `json:"runs"`
+			WorldRecords int    `json:"worldRecords"`
+			Points       int    `json:"points"`
+		}
+		type countryJSON struct {
+			Code         string       `json:"code"`
+			Country      string       `json:"country"`
+			WorldRecords int          `json:"worldRecords"`
+			Points       int          `json:"points"`
+			BestRuns     []runJSON    `json:"bestRuns"`
+			Runners      []runnerJSON `json:"runners"`
+		}
+		result := &countryJSON{standing.Code, standing.FormatCountry(), standing.WorldRecords,
+			standing.Points, []runJSON{}, []runnerJSON{}}
+		for _, run := range leaderboard.BestRuns {
+			result.BestRuns = append(result.BestRuns,
+				runJSON{run.Category.Name, run.RankInCategory, run.Runner.Username,
+					run.FormatScore(), run.Platform.Name, run.Link, run.Comment})
+		}
+		for _, runner := range leaderboard.Runners {
+			result.Runners = append(result.Runners,
+				runnerJSON{runner.Runner.Username, runner.Runs, runner.WorldRecords, runner.Points})
+		}
+		body, err := json.Marshal(result)
+		if err != nil {
+			log.Println("Could not write json: ", err)
+			http.Error(w, "Internal server error", 500)
+			return
+		}
+		w.Write(body)
+	case "xml":
+		w.Header().Set("Content-Type", "text/xml")
+		type runXML struct {
+			XMLName   xml.Name `xml:"run"`
+			Category  string   `xml:"category,attr"`
+			Rank      int      `xml:"rank"`
+			Player    string   `xml:"player"`
+			Result    string   `xml:"result"`
+			Platform  string   `xml:"platform"`
+			VideoLink string   `xml:"videoLink"`
+			Comment   string   `xml:"comment"`
+		}
+		type runnerXML struct {
+			XMLName      xml.Name `xml:"runner"`
+			Player       string   `xml:"player"`
+			Runs         int      `xml:"runs"`
+			WorldRecords int      `xml:"worldRecords"`
+			Points       int      `xml:"points"`
+		}
+		type countryXML struct {
+			XMLName      xml.Name    `xml:"country"`
+			Code         string      `xml:"code,attr"`
+			Country      string      `xml:"name"`
+			WorldRecords int         `xml:"worldRecords"`
+			Points       int         `xml:"points"`
+			BestRuns     []runXML    `xml:"bestRuns>run"`
+			Runners      []runnerXML `xml:"runners>runner"`
+		}
+		result := &countryXML{Code: standing.Code, Country: standing.FormatCountry(),
+			WorldRecords: standing.WorldRecords, Points: standing.Points}
+		for _, run := range leaderboard.BestRuns {
+			result.BestRuns = append(result.BestRuns,
+				runXML{Category: run.Category.Name, Rank: run.RankInCategory, Player: run.Runner.Username,
+					Result: run.FormatScore(), Platform: run.Platform.Name, VideoLink: run.Link, Comment: run.Comment})
+		}
+		for _, runner := range leaderboard.Runners {
+			result.Runners = append(result.Runners,
+				runnerXML{Player: runner.Runner.Username, Runs: runner.Runs,
+					WorldRecords: runner.WorldRecords, Points: runner.Points})
+		}
+		body, err := xml.Marshal(result)
+		if err != nil {
+			log.Println("Could not write xml: ", err)
+			http.Error(w, "Internal server error", 500)
+			return
+		}
+		w.Write(body)
+	}
+}
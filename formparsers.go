@@ -4,6 +4,8 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 )
 
 // getFormValue returns the value of a given POST parameter if non-empty
@@ -15,8 +17,39 @@ func getFormValue(r *http.Request, key string) (string, error) {
 	return "", errors.New(key + " was not a POST parameter")
 }
 
+// getIntFormValue returns the value of a given POST parameter, if it is
+// an integer.
+func getIntFormValue(r *http.Request, key string) (int, error) {
+	formValue, err := getFormValue(r, key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(formValue)
+}
+
 // Below follows parsers for all forms on the websit, ordered alphabetically.
 
+// appealFormParser parses forms posted to "/appeal*", and returns the
+// explanation given.
+func appealFormParser(r *http.Request) (string, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return "", errors.New("Could not parse form contents.")
+	}
+	err = checkCSRFToken(r)
+	if err != nil {
+		return "", err
+	}
+	explanation, err := getFormValue(r, "explanation")
+	if err != nil || explanation == "" {
+		return "", errors.New("Explanation given can not be empty.")
+	}
+	if len(explanation) > 500 {
+		return "", errors.New("Explanation can be at most 500 characters.")
+	}
+	return explanation, nil
+}
+
 // contactFormParser parses the contact form, and returns the name, email,
 // subject, and message on success.
 func contactFormParser(r *http.Request) (name string, email string,
@@ -25,6 +58,10 @@ func contactFormParser(r *http.Request) (name string, email string,
 	if err != nil {
 		return "", "", "", "", errors.New("Could not read form contents.")
 	}
+	err = checkCSRFToken(r)
+	if err != nil {
+		return "", "", "", "", err
+	}
 	name, nameErr := getFormValue(r, "name")
 	email, emailErr := getFormValue(r, "email")
 	subject, subjectErr := getFormValue(r, "subject")
@@ -49,57 +86,206 @@ func contactFormParser(r *http.Request) (name string, email string,
 	return
 }
 
+// editProfileFormParser parses forms posted to "/edit-profile" by a given
+// user, and returns the user with their profile updated accordingly, as well
+// as the new password, if any.
+func editProfileFormParser(r *http.Request, user runner) (updatedUser runner,
+	password string, err error) {
+	updatedUser = user
+	err = r.ParseForm()
+	if err != nil {
+		err = errors.New("Could not parse form contents.")
+		return
+	}
+	err = checkCSRFToken(r)
+	if err != nil {
+		return
+	}
+	username, usernameErr := getFormValue(r, "username")
+	email, emailErr := getFormValue(r, "email")
+	country, countryErr := getFormValue(r, "country")
+	spelunkerID, spelunkerErr := getIntFormValue(r, "spelunker")
+	psn, psnErr := getFormValue(r, "psn")
+	twitch, twitchErr := getFormValue(r, "twitch")
+	youTube, youTubeErr := getFormValue(r, "youtube")
+	freeText, freeTextErr := getFormValue(r, "freetext")
+	password, passwordErr := getFormValue(r, "password")
+	password2, password2Err := getFormValue(r, "password2")
+	if usernameErr != nil || emailErr != nil || countryErr != nil || spelunkerErr != nil ||
+		psnErr != nil || twitchErr != nil || youTubeErr != nil ||
+		freeTextErr != nil || passwordErr != nil || password2Err != nil {
+		err = errors.New("Could not parse form contents.")
+		return
+	}
+	updatedUser.Username = username
+	if email != user.Email {
+		updatedUser.Email = email
+		updatedUser.EmailVerified = false
+	}
+	updatedUser.Country = country
+	updatedUser.Spelunker = spelunker{ID: spelunkerID}
+	updatedUser.Psn = psn
+	updatedUser.Twitch = twitch
+	updatedUser.YouTube = youTube
+	updatedUser.FreeText = freeText
+	// Unchecked checkboxes are simply not part of the form.
+	_, updatedUser.EmailFlag = r.Form["emailflag"]
+	_, updatedUser.EmailWr = r.Form["emailwr"]
+	_, updatedUser.EmailChallenge = r.Form["emailchallenge"]
+	updatedUser.EmailChallenge = updatedUser.EmailChallenge && updatedUser.EmailWr
+	if password != password2 {
+		err = errors.New("The two passwords do not match.")
+		return
+	}
+	// An empty password leaves the password unchanged.
+	if password != "" {
+		err = checkPassword(password)
+		if err != nil {
+			return
+		}
+	}
+	err = updatedUser.validate()
+	return
+}
+
 // loginFormParser parses POST requests to "/login". Returns the
 // user to log in on success, and the form contents in either case.
 func loginFormParser(r *http.Request) (username string, password string,
-	user runner, err error) {
+	remember bool, user runner, err error) {
 	err = r.ParseForm()
 	if err != nil {
 		err = errors.New("Could not parse form contents.")
 		return
 	}
+	err = checkCSRFToken(r)
+	if err != nil {
+		return
+	}
 	username, usernameErr := getFormValue(r, "username")
 	password, passwordErr := getFormValue(r, "password")
-	if usernameErr != nil || !isLegitUsername(username) {
-		err = errors.New("Invalid username.")
+	_, remember = r.Form["remember"]
+	if usernameErr != nil || !isLegitUsername(username) ||
+		passwordErr != nil || !isLegitPassword(password) {
+		err = errIncorrectLogin
 		return
 	}
-	if passwordErr != nil || !isLegitPassword(password) {
-		err = errors.New("Invalid password.")
+	err = checkLoginAllowed(r, username)
+	if err != nil {
 		return
 	}
 	user, err = getRunnerByUsername(username)
 	if err != nil {
-		err = errors.New("Could not find a user with that username.")
+		spendLoginTime(password)
+	} else {
+		err = user.testLogin(password)
+	}
+	if err != nil {
+		recordLoginFailure(r, username)
+		err = errIncorrectLogin
+		return
+	}
+	recordLoginSuccess(username)
+	return
+}
+
+// moderationFormParser parses forms posted to "/moderation", and returns
+// the run in question, the action to take ("approve" or "reject" for runs
+// waiting for approval, "unflag" or "dismiss" for appealed runs), and the
+// explanation given for rejections.
+func moderationFormParser(r *http.Request) (moderatedRun run, action string,
+	explanation string, err error) {
+	err = r.ParseForm()
+	if err != nil {
+		err = errors.New("Could not parse form contents.")
+		return
+	}
+	err = checkCSRFToken(r)
+	if err != nil {
+		return
+	}
+	runID, runIDErr := getIntFormValue(r, "runID")
+	action, actionErr := getFormValue(r, "action")
+	explanation, _ = getFormValue(r, "explanation")
+	if runIDErr != nil {
+		err = errors.New("Could not parse run ID.")
 		return
 	}
-	err = user.testLogin(password)
+	moderatedRun, err = getRunByID(runID)
 	if err != nil {
-		err = errors.New("Incorrect password.")
+		err = errors.New("Could not find run.")
+		return
+	}
+	switch {
+	case actionErr != nil:
+		err = errors.New("Unknown action.")
+	case action == "approve" || action == "reject":
+		if !moderatedRun.Pending || moderatedRun.Flag != "" {
+			err = errors.New("Run is not waiting for approval.")
+		} else if action == "reject" && explanation == "" {
+			err = errors.New("Explanation given can not be empty.")
+		}
+	case action == "unflag":
+		if moderatedRun.Flag == "" {
+			err = errors.New("Run is not flagged.")
+		}
+	case action == "dismiss":
+		if moderatedRun.Appeal == "" || moderatedRun.AppealDismissed {
+			err = errors.New("Run has no open appeal.")
+		}
+	default:
+		err = errors.New("Unknown action.")
 	}
 	return
 }
 
-// passwordResetFormHandler parses POST requests to "/password-reset",
-// and returns the user whose password should be reset.
-func passwordResetFormParser(r *http.Request) (runner, error) {
-	err := r.ParseForm()
+// passwordResetFormParser parses POST requests to "/password-reset",
+// and returns the username and email address given.
+func passwordResetFormParser(r *http.Request) (username string, email string, err error) {
+	err = r.ParseForm()
 	if err != nil {
-		return runner{}, errors.New("Could not parse form contents.")
+		err = errors.New("Could not parse form contents.")
+		return
 	}
-	username, err := getFormValue(r, "username")
+	err = checkCSRFToken(r)
+	if err != nil {
+		return
+	}
+	username, err = getFormValue(r, "username")
 	if err != nil || username == "" {
-		return runner{}, errors.New("Username entry can not be empty.")
+		err = errors.New("Username entry can not be empty.")
+		return
 	}
-	email, err := getFormValue(r, "email")
+	email, err = getFormValue(r, "email")
 	if err != nil || email == "" {
-		return runner{}, errors.New("Email entry can not be empty.")
+		err = errors.New("Email entry can not be empty.")
+		return
+	}
+	return
+}
+
+// passwordResetTokenFormParser parses POST requests to
+// "/password-reset/{token}", and returns the new password.
+func passwordResetTokenFormParser(r *http.Request) (string, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return "", errors.New("Could not parse form contents.")
 	}
-	user, err := getRunnerByUsernameAndEmail(username, email)
+	err = checkCSRFToken(r)
 	if err != nil {
-		return runner{}, errors.New("Could not find any user with that combination of username and email. ")
+		return "", err
 	}
-	return user, nil
+	password, passwordErr := getFormValue(r, "password")
+	password2, password2Err := getFormValue(r, "password2")
+	if passwordErr != nil || password2Err != nil {
+		return "", errors.New("Could not parse password.")
+	}
+	if err := checkPassword(password); err != nil {
+		return "", err
+	}
+	if password != password2 {
+		return "", errors.New("The two passwords do not match.")
+	}
+	return password, nil
 }
 
 // registerFormParser parses forms posted to "/register" and returns
@@ -111,6 +297,10 @@ func registerFormParser(r *http.Request) (username string, email string,
 		err = errors.New("Could not parse form contents.")
 		return
 	}
+	err = checkCSRFToken(r)
+	if err != nil {
+		return
+	}
 	username, usernameErr := getFormValue(r, "username")
 	email, emailErr := getFormValue(r, "email")
 	password, passwordErr := getFormValue(r, "password")
@@ -139,6 +329,10 @@ func registerFormParser(r *http.Request) (username string, email string,
 		err = errors.New("Email address looks illegit.")
 		return
 	}
+	err = checkPassword(password)
+	if err != nil {
+		return
+	}
 	if password != password2 {
 		err = errors.New("The two passwords to not match.")
 		return
@@ -151,14 +345,172 @@ func registerFormParser(r *http.Request) (username string, email string,
 	return
 }
 
+// reportFormParser parses forms posted to "/report*" and "/flag-run*",
+// and returns the explanation given.
 func reportFormParser(r *http.Request) (string, error) {
 	err := r.ParseForm()
 	if err != nil {
 		return "", errors.New("Could not parse form contents.")
 	}
+	err = checkCSRFToken(r)
+	if err != nil {
+		return "", err
+	}
 	explanation, err := getFormValue(r, "explanation")
 	if err != nil || explanation == "" {
 		return "", errors.New("Explanation given can not be empty.")
 	}
 	return explanation, nil
 }
+
+// roleFormParser parses forms posted to "/admin/roles", and returns the
+// runner whose role should change, the new role, and the categories they
+// should moderate, if any.
+func roleFormParser(r *http.Request) (target runner, role string,
+	categoryIDs []int, err error) {
+	err = r.ParseForm()
+	if err != nil {
+		err = errors.New("Could not parse form contents.")
+		return
+	}
+	err = checkCSRFToken(r)
+	if err != nil {
+		return
+	}
+	username, err := getFormValue(r, "username")
+	if err != nil {
+		err = errors.New("Username can not be empty.")
+		return
+	}
+	target, err = getRunnerByUsername(username)
+	if err != nil {
+		err = errors.New("No runner with the given username.")
+		return
+	}
+	role, err = getFormValue(r, "role")
+	if err != nil {
+		err = errors.New("Role can not be empty.")
+		return
+	}
+	for _, value := range r.Form["categories"] {
+		categoryID, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			err = errors.New("Could not parse category.")
+			return
+		}
+		categoryIDs = append(categoryIDs, categoryID)
+	}
+	return
+}
+
+// submitRunFormParser parses forms posted to "/submit-run" by a given
+// runner, and returns the run described by the form. The run is returned
+// even in case of errors, so that the form can be filled out again.
+func submitRunFormParser(r *http.Request, user runner) (newRun run, err error) {
+	newRun.Runner = user
+	err = r.ParseForm()
+	if err != nil {
+		err = errors.New("Could not parse form contents.")
+		return
+	}
+	err = checkCSRFToken(r)
+	if err != nil {
+		return
+	}
+	categoryID, categoryErr := getIntFormValue(r, "category")
+	world, worldErr := getIntFormValue(r, "world")
+	floor, floorErr := getIntFormValue(r, "level")
+	spelunkerID, spelunkerErr := getIntFormValue(r, "spelunker")
+	platformID, platformErr := getIntFormValue(r, "platform")
+	link, linkErr := getFormValue(r, "link")
+	comment, commentErr := getFormValue(r, "comment")
+	newRun.Link = link
+	newRun.Comment = comment
+	newRun.Platform, _ = getPlatformByID(platformID)
+	newRun.Level = 4*(world-1) + floor
+	newRun.Spelunker, _ = getSpelunkerByID(spelunkerID)
+	if categoryErr != nil {
+		err = errors.New("Could not parse category.")
+		return
+	}
+	newRun.Category, err = getCategoryByID(categoryID)
+	if err != nil {
+		err = errors.New("Unknown category.")
+		return
+	}
+	// How the result is entered depends on the goal of the category.
+	switch newRun.Category.Goal {
+	case "Score":
+		score, scoreErr := getIntFormValue(r, "score")
+		if scoreErr != nil || score <= 0 {
+			err = errors.New("Score must be a positive integer.")
+			return
+		}
+		newRun.Score = score
+	case "Time":
+		minutes, minutesErr := getIntFormValue(r, "minutes")
+		seconds, secondsErr := getIntFormValue(r, "seconds")
+		milliseconds, millisecondsErr := getIntFormValue(r, "milliseconds")
+		if minutesErr != nil || minutes < 0 {
+			err = errors.New("Minutes must be a non-negative integer.")
+			return
+		}
+		if secondsErr != nil || seconds < 0 || seconds >= 60 {
+			err = errors.New("Seconds must be an integer between 0 and 59.")
+			return
+		}
+		if millisecondsErr != nil || milliseconds < 0 || milliseconds >= 1000 {
+			err = errors.New("Milliseconds must be an integer between 0 and 999.")
+			return
+		}
+		newRun.Score = 60000*minutes + 1000*seconds + milliseconds
+		if newRun.Score == 0 {
+			err = errors.New("Time can not be zero.")
+			return
+		}
+	default:
+		err = errors.New("Category has unknown goal " + newRun.Category.Goal + ".")
+		return
+	}
+	if worldErr != nil || world < 1 || world > 5 {
+		err = errors.New("World must be between 1 and 5.")
+		return
+	}
+	if floorErr != nil || floor < 1 || floor > 4 {
+		err = errors.New("Level must be between 1 and 4.")
+		return
+	}
+	if spelunkerErr != nil || newRun.Spelunker.Name == "" {
+		err = errors.New("Unknown spelunker.")
+		return
+	}
+	if platformErr != nil || newRun.Platform.Name == "" {
+		err = errors.New("Unknown platform.")
+		return
+	}
+	if linkErr != nil {
+		err = errors.New("Could not parse video link.")
+		return
+	}
+	if link != "" {
+		parsedLink, linkErr := url.Parse(link)
+		if linkErr != nil || (parsedLink.Scheme != "http" && parsedLink.Scheme != "https") {
+			err = errors.New("Video link must begin with http:// or https://.")
+			return
+		}
+	}
+	// The lengths are bounded by the sizes of the database columns.
+	if len(link) > 100 {
+		err = errors.New("Video link can be at most 100 characters long.")
+		return
+	}
+	if commentErr != nil || comment == "" {
+		err = errors.New("Comment can not be empty.")
+		return
+	}
+	if len(comment) > 150 {
+		err = errors.New("Comment can be at most 150 characters long.")
+		return
+	}
+	return
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -13,6 +17,96 @@ func aboutHandler(w http.ResponseWriter, r *http.Request) {
 	renderContent("tmpl/about.html", r, w, nil)
 }
 
+// adminRolesHandler handles GET and POST requests to "/admin/roles", where
+// admins grant and revoke the roles of runners.
+func adminRolesHandler(w http.ResponseWriter, r *http.Request) {
+	activeUser, err := getActiveUser(r)
+	if err != nil || !activeUser.IsAdmin() {
+		http.NotFound(w, r)
+		return
+	}
+	type adminRolesData struct {
+		Success    string
+		Error      string
+		Staff      []runner
+		Roles      []string
+		Categories []category
+	}
+	var success string
+	var errorString string
+
+	if r.Method == "POST" {
+		target, role, categoryIDs, err := roleFormParser(r)
+		if err != nil {
+			errorString = err.Error()
+		} else {
+			err = target.setRole(activeUser, role, categoryIDs)
+			if err != nil {
+				errorString = err.Error()
+			} else {
+				success = target.Username + " is now " + target.FormatRole() + "."
+			}
+		}
+	}
+
+	staff, err := getStaff()
+	if err != nil {
+		log.Println("Could not get staff: ", err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	data := adminRolesData{success, errorString, staff, roles, getAllCategories()}
+	renderContent("tmpl/adminroles.html", r, w, data)
+}
+
+// appealHandler handles GET and POST requests to "/appeal*", through which
+// runners appeal the flags on their runs.
+func appealHandler(w http.ResponseWriter, r *http.Request) {
+	type appealData struct {
+		Run     *run
+		Success bool
+		Error   string
+	}
+	success := false
+	var errorString string
+
+	activeUser, err := getActiveUser(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	runID, err := strconv.Atoi(mux.Vars(r)["runID"])
+	if err != nil {
+		log.Println("Could not parse run ID: ", err)
+		http.NotFound(w, r)
+		return
+	}
+	run, err := getRunByID(runID)
+	// Only the owner of a flagged run gets to appeal it.
+	if err != nil || run.Runner.ID != activeUser.ID || run.Flag == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == "POST" {
+		explanation, err := appealFormParser(r)
+		if err != nil {
+			errorString = err.Error()
+		} else {
+			err = run.appeal(explanation)
+			if err != nil {
+				log.Println("Could not appeal flag: ", err)
+				errorString = err.Error()
+			} else {
+				success = true
+			}
+		}
+	}
+
+	data := appealData{&run, success, errorString}
+	renderContent("tmpl/appeal.html", r, w, data)
+}
+
 // categoryHandler handles GET requests to "/category*"
 func categoryHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -21,7 +115,14 @@ func categoryHandler(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	runs, err := getRunsByCategory(cat, 0)
+	// Leaderboards can be filtered, as in "/category/hell?spelunker=9"; see
+	// runfilter.go. Invalid filters are ignored, but the error is shown.
+	var errorString string
+	filter, err := parseRunFilter(r.URL.Query())
+	if err != nil {
+		errorString = err.Error()
+	}
+	runs, err := getFilteredRuns(cat, filter, 0)
 	if err != nil {
 		log.Println("Could not get runs: ", err)
 		http.Error(w, "Internal server error", 500)
@@ -32,11 +133,41 @@ func categoryHandler(w http.ResponseWriter, r *http.Request) {
 		Category          category
 		Runs              []run
 		HighlightedRunner string
+		Error             string
+		Filter            *runFilter
+		Platforms         []platform
+		Spelunkers        []spelunker
+		Countries         map[string]string
 	}
-	data := categoryData{cat, runs, highlightedRunner}
+	data := categoryData{cat, runs, highlightedRunner, errorString, &filter,
+		platforms, spelunkers, countries}
 	renderContent("tmpl/category.html", r, w, data)
 }
 
+// categoryHistoryHandler handles GET requests to "/category/*/history"
+func categoryHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	cat, err := getCategoryByAbbr(mux.Vars(r)["categoryName"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	records, err := getWorldRecordHistory(cat)
+	if err != nil {
+		log.Println("Could not get world record history: ", err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	// Newest records are the most interesting, so they go first.
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	type categoryHistoryData struct {
+		Category category
+		Records  []worldRecord
+	}
+	renderContent("tmpl/categoryhistory.html", r, w, categoryHistoryData{cat, records})
+}
+
 // contactHandler handles GET and POST requests to "/contact"
 func contactHandler(w http.ResponseWriter, r *http.Request) {
 	// We keep track of user input in the template data to provide
@@ -79,22 +210,139 @@ func contactHandler(w http.ResponseWriter, r *http.Request) {
 	renderContent("tmpl/contact.html", r, w, data)
 }
 
-// editProfileHandler handles GET requests to "/edit-profile"
+// countriesHandler handles GET requests to "/countries"
+func countriesHandler(w http.ResponseWriter, r *http.Request) {
+	standings, err := getCountryStandings()
+	if err != nil {
+		log.Println("Could not get country standings: ", err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	type countriesData struct {
+		Standings         []countryStanding
+		PointsDescription string
+	}
+	renderContent("tmpl/countries.html", r, w, countriesData{standings, describePoints()})
+}
+
+// countryHandler handles GET requests to "/country/{countryCode}"
+func countryHandler(w http.ResponseWriter, r *http.Request) {
+	leaderboard, err := getCountryLeaderboard(mux.Vars(r)["countryCode"])
+	if err == errNoSuchCountry {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Println("Could not get country leaderboard: ", err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	renderContent("tmpl/country.html", r, w, &leaderboard)
+}
+
+// dailyHandler handles GET requests to "/daily", the latest daily
+// challenge leaderboard, and to "/daily/{date}".
+func dailyHandler(w http.ResponseWriter, r *http.Request) {
+	dailies, err := getDailies(30)
+	if err != nil {
+		log.Println("Could not get dailies: ", err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	type dailyData struct {
+		Daily    *daily
+		Dailies  []daily
+		Entries  []dailyEntry
+		Page     int
+		PrevPage int
+		NextPage int
+	}
+	data := dailyData{Dailies: dailies}
+	var day time.Time
+	if date, ok := mux.Vars(r)["date"]; ok {
+		day, err = parseDailyDate(date)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+	} else if len(dailies) > 0 {
+		day = dailies[0].Date
+	} else {
+		renderContent("tmpl/daily.html", r, w, data)
+		return
+	}
+	page, perPage := getPageParameters(r)
+	entries, total, err := getDailyEntries(day, (page-1)*perPage, perPage)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Println("Could not get daily entries: ", err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	data.Daily = &daily{day, total}
+	data.Entries = entries
+	data.Page = page
+	if page > 1 {
+		data.PrevPage = page - 1
+	}
+	if page*perPage < total {
+		data.NextPage = page + 1
+	}
+	renderContent("tmpl/daily.html", r, w, data)
+}
+
+// editProfileHandler handles GET and POST requests to "/edit-profile"
 func editProfileHandler(w http.ResponseWriter, r *http.Request) {
 	// First, let's make sure that the user is logged in
-	if _, err := getActiveUser(r); err != nil {
+	user, err := getActiveUser(r)
+	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
+	// The form is filled out with Runner, which in case of errors
+	// contains the user input rather than what is in the database.
 	type editProfileData struct {
 		Success    bool
 		Error      string
+		Runner     *runner
 		Countries  map[string]string
 		Spelunkers []spelunker
 	}
 	success := false
 	var errorString string
-	data := editProfileData{success, errorString, countries, spelunkers}
+	if r.Method == "POST" {
+		var password string
+		oldEmail := user.Email
+		user, password, err = editProfileFormParser(r, user)
+		if err != nil {
+			errorString = err.Error()
+		} else {
+			err = user.update(password)
+			if err != nil {
+				errorString += "Could not update your profile. Please try again later. "
+				log.Println(err)
+			} else {
+				success = true
+				if user.Email != oldEmail && user.Email != "" {
+					emailVerificationsByAccount.allow(strconv.Itoa(user.ID))
+					err = user.requestEmailVerification()
+					if err != nil {
+						log.Println("Could not send email verification link: ", err)
+					}
+				}
+				// A new password should lock out anybody else using
+				// the account.
+				if password != "" {
+					err = endOtherSessions(r, user)
+					if err != nil {
+						log.Println("Could not end sessions: ", err)
+					}
+				}
+			}
+		}
+	}
+	data := editProfileData{success, errorString, &user, countries, spelunkers}
 	renderContent("tmpl/editprofile.html", r, w, data)
 }
 
@@ -102,7 +350,8 @@ func editProfileHandler(w http.ResponseWriter, r *http.Request) {
 func flagRunHandler(w http.ResponseWriter, r *http.Request) {
 	// Before doing anything, let us ensure that the current user
 	// is allowed to flag runs.
-	if activeUser, err := getActiveUser(r); !activeUser.IsModerator() || err != nil {
+	activeUser, err := getActiveUser(r)
+	if !activeUser.IsModerator() || err != nil {
 		http.Error(w, "Internal server error", 500)
 		return
 	}
@@ -128,13 +377,17 @@ func flagRunHandler(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	if !activeUser.CanModerate(run.Category) {
+		http.Error(w, "You can not moderate runs in this category.", http.StatusForbidden)
+		return
+	}
 
 	if r.Method == "POST" {
 		explanation, err := reportFormParser(r) // This is a /bit/ lazy.
 		if err != nil {
 			errorString = err.Error()
 		} else {
-			err = run.flag(explanation)
+			err = run.flag(activeUser, explanation)
 			if err != nil {
 				errorString += "Could not flag the run:" + err.Error()
 			} else {
@@ -156,9 +409,19 @@ func frontPageHandler(w http.ResponseWriter, r *http.Request) {
 		Description string
 		Records     []run
 	}
+	// The records on each platform are shown as a table with a row per
+	// category and a column per platform.
+	type categoryWithPlatformRecords struct {
+		Category category
+		// Records holds the record on each platform in `platforms`, or nil
+		// if there are no runs on the platform.
+		Records []*run
+	}
 	type frontPageData struct {
-		News         []newsEntry
-		WorldRecords []classWithRecords
+		News            []newsEntry
+		WorldRecords    []classWithRecords
+		Platforms       []platform
+		PlatformRecords []categoryWithPlatformRecords
 	}
 	allWorldRecords, err := getAllWorldRecords()
 	var mainWRs []run
@@ -181,7 +444,23 @@ func frontPageHandler(w http.ResponseWriter, r *http.Request) {
 		classWithRecords{"Main categories", mainWRs},
 		classWithRecords{"Challenge categories", challengeWRs},
 	}
-	data := frontPageData{readNews(), worldRecords}
+
+	var platformRecords []categoryWithPlatformRecords
+	for _, cat := range getAllCategories() {
+		platformRecords = append(platformRecords, categoryWithPlatformRecords{cat, nil})
+	}
+	for _, p := range platforms {
+		records, err := getWorldRecordsByPlatform(p)
+		if err != nil {
+			log.Println("Could not get world records: ", err)
+			http.Error(w, "Internal server error", 500)
+			return
+		}
+		for i, record := range records {
+			platformRecords[i].Records = append(platformRecords[i].Records, record)
+		}
+	}
+	data := frontPageData{readNews(), worldRecords, platforms, platformRecords}
 	renderContent("tmpl/frontpage.html", r, w, data)
 }
 
@@ -190,22 +469,26 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	type loginData struct {
 		Success       bool
 		Error         string
+		Locked        bool
 		UsernameInput string
 		PasswordInput string
 	}
 	success := false
 	var errorString string
+	var locked bool
 	var username string
 	var password string
+	var remember bool
 	var user runner
 	var err error
 
 	if r.Method == "POST" {
-		username, password, user, err = loginFormParser(r)
+		username, password, remember, user, err = loginFormParser(r)
 		if err != nil {
 			errorString = err.Error()
+			_, locked = err.(loginLockedError)
 		} else {
-			err = setActiveUser(r, w, user)
+			err = setActiveUser(r, w, user, remember)
 			if err != nil {
 				log.Println(err)
 				http.Error(w, "Internal server error", 500)
@@ -215,72 +498,259 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	data := loginData{success, errorString, username, password}
+	data := loginData{success, errorString, locked, username, password}
 
 	renderContent("tmpl/login.html", r, w, data)
 }
 
-// logOutHandler handles GET requests to "/log-out"
+// logOutHandler handles GET and POST requests to "/log-out". Logging out
+// takes a POST, so that other sites can not log out our users. Posting
+// everywhere=1 ends all sessions of the user, not just the current one.
 func logOutHandler(w http.ResponseWriter, r *http.Request) {
-	// A natural way to log out would be to set the session
-	// cookie max-age to -1, but that adds an unnecessary layer
-	// of complexity for when the user wants to log back in.
-	// Instead we just change the user to one that doesn't exist.
-	session, err := cookieStore.Get(r, "login")
+	type logOutData struct {
+		LoggedOut  bool
+		Everywhere bool
+		Error      string
+	}
+	var data logOutData
+	if r.Method == "POST" {
+		r.ParseForm()
+		err := checkCSRFToken(r)
+		if err != nil {
+			data.Error = err.Error()
+		} else {
+			data.Everywhere = r.PostFormValue("everywhere") == "1"
+			err = logOut(r, w, data.Everywhere)
+			if err != nil {
+				log.Println(err)
+				http.Error(w, "Internal server error", 500)
+				return
+			}
+			data.LoggedOut = true
+		}
+	}
+	renderContent("tmpl/logout.html", r, w, data)
+}
+
+// moderationHandler handles GET and POST requests to "/moderation", the
+// queues of runs waiting for approval and of appealed flags.
+func moderationHandler(w http.ResponseWriter, r *http.Request) {
+	activeUser, err := getActiveUser(r)
+	if err != nil || !activeUser.IsModerator() {
+		http.NotFound(w, r)
+		return
+	}
+	// To help moderators judge a run, we show what the runner has
+	// submitted before.
+	type pendingRun struct {
+		Run         run
+		CurrentRun  *run
+		RunCount    int
+		FlaggedRuns []run
+	}
+	type moderationData struct {
+		Success      string
+		Error        string
+		PendingRuns  []pendingRun
+		AppealedRuns []run
+	}
+	var success string
+	var errorString string
+
+	if r.Method == "POST" {
+		moderatedRun, action, explanation, err := moderationFormParser(r)
+		if err != nil {
+			errorString = err.Error()
+		} else if !activeUser.CanModerate(moderatedRun.Category) {
+			errorString = "You can not moderate runs in this category."
+		} else {
+			switch action {
+			case "approve":
+				err = moderatedRun.approve(activeUser)
+				success = "The run has been approved."
+			case "reject":
+				err = moderatedRun.flag(activeUser, explanation)
+				success = "The run has been rejected."
+			case "unflag":
+				err = moderatedRun.unflag(activeUser)
+				success = "The run has been unflagged."
+			case "dismiss":
+				err = moderatedRun.dismissAppeal(activeUser)
+				success = "The appeal has been dismissed."
+			}
+			if err != nil {
+				errorString = "Could not carry out the action: " + err.Error()
+				success = ""
+			}
+		}
+	}
+
+	runs, err := getPendingRuns()
 	if err != nil {
-		log.Println(err)
+		log.Println("Could not get pending runs: ", err)
 		http.Error(w, "Internal server error", 500)
 		return
 	}
-	session.Values["userID"] = 0
-	session.Save(r, w)
-	renderContent("tmpl/logout.html", r, w, nil)
+	pendingRuns := []pendingRun{}
+	for _, run := range runs {
+		if !activeUser.CanModerate(run.Category) {
+			continue
+		}
+		history, err := getRunsByRunnerID(run.Runner.ID)
+		if err != nil {
+			log.Println("Could not get runs: ", err)
+			http.Error(w, "Internal server error", 500)
+			return
+		}
+		p := pendingRun{Run: run, RunCount: len(history)}
+		for i, oldRun := range history {
+			if oldRun.Flag != "" {
+				p.FlaggedRuns = append(p.FlaggedRuns, oldRun)
+			} else if !oldRun.Pending && !oldRun.IsObsolete() && oldRun.Category.ID == run.Category.ID {
+				p.CurrentRun = &history[i]
+			}
+		}
+		pendingRuns = append(pendingRuns, p)
+	}
+	runs, err = getAppealedRuns()
+	if err != nil {
+		log.Println("Could not get appealed runs: ", err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	appealedRuns := []run{}
+	for _, run := range runs {
+		if activeUser.CanModerate(run.Category) {
+			appealedRuns = append(appealedRuns, run)
+		}
+	}
+
+	data := moderationData{success, errorString, pendingRuns, appealedRuns}
+	renderContent("tmpl/moderation.html", r, w, data)
+}
+
+// moderationLogHandler handles GET requests to "/moderation/log", the audit
+// log, which may be filtered by the username of the actor, the category, and
+// the action.
+func moderationLogHandler(w http.ResponseWriter, r *http.Request) {
+	if activeUser, err := getActiveUser(r); err != nil || !activeUser.IsModerator() {
+		http.NotFound(w, r)
+		return
+	}
+	type moderationLogData struct {
+		Error      string
+		Entries    []auditEntry
+		Categories []category
+		Actions    []auditAction
+		Actor      string
+		CategoryID int
+		Action     string
+	}
+	var errorString string
+	var filter auditFilter
+	actor := r.URL.Query().Get("actor")
+	if actor != "" {
+		actorRunner, err := getRunnerByUsername(actor)
+		if err != nil {
+			errorString = "No runner with the given username."
+		}
+		filter.ActorID = actorRunner.ID
+	}
+	filter.CategoryID, _ = strconv.Atoi(r.URL.Query().Get("category"))
+	filter.Action = r.URL.Query().Get("action")
+
+	var entries []auditEntry
+	if errorString == "" {
+		var err error
+		entries, err = getAuditLog(filter, 500)
+		if err != nil {
+			log.Println("Could not get audit log: ", err)
+			http.Error(w, "Internal server error", 500)
+			return
+		}
+	}
+	data := moderationLogData{errorString, entries, getAllCategories(), auditActions,
+		actor, filter.CategoryID, filter.Action}
+	renderContent("tmpl/moderationlog.html", r, w, data)
 }
 
 // notFoundHandler handles all 404s
 func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	// The session has to be saved before the status is written, or its
+	// cookie is lost; renderContent then finds the token in the session.
+	getCSRFToken(r, w)
 	w.WriteHeader(404)
 	renderContent("tmpl/404.html", r, w, nil)
 }
 
-// passwordResetHandler handles GET and POST requests to "/password-reset"
+// passwordResetHandler handles GET and POST requests to "/password-reset",
+// where runners can ask for a link to choose a new password.
 func passwordResetHandler(w http.ResponseWriter, r *http.Request) {
 	type passwordResetData struct {
-		PasswordReset bool
-		Error         string
+		Requested bool
+		Error     string
 	}
-	passwordReset := false
-	var errorString string
-
+	var data passwordResetData
 	if r.Method == "POST" {
-		user, err := passwordResetFormParser(r)
+		username, email, err := passwordResetFormParser(r)
 		if err != nil {
-			errorString = err.Error()
+			data.Error = err.Error()
+		} else if !passwordResetsByIP.allow(clientIP(r)) ||
+			!passwordResetsByAccount.allow(strings.ToLower(username)) {
+			data.Error = errTooManyPasswordResets.Error()
 		} else {
-			newPassword, err := generatePassword()
-			if err != nil {
+			// Whether or not we find the user, the response is the same, so
+			// that the form can not be used to find the emails of users.
+			user, err := getRunnerByUsernameAndEmail(username, email)
+			if err == nil {
+				err = user.requestPasswordReset()
+				if err != nil {
+					log.Println("Could not send password reset link: ", err)
+				}
+			}
+			data.Requested = true
+		}
+	}
+	renderContent("tmpl/passwordreset.html", r, w, data)
+}
+
+// passwordResetTokenHandler handles GET and POST requests to
+// "/password-reset/{token}", where runners choose a new password.
+func passwordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	type passwordResetTokenData struct {
+		Token         string
+		ValidToken    bool
+		PasswordReset bool
+		Error         string
+	}
+	token := mux.Vars(r)["token"]
+	data := passwordResetTokenData{Token: token}
+	user, err := getRunnerByPasswordResetToken(token)
+	if err != nil {
+		data.Error = err.Error()
+		renderContent("tmpl/passwordresettoken.html", r, w, data)
+		return
+	}
+	data.ValidToken = true
+	if r.Method == "POST" {
+		password, err := passwordResetTokenFormParser(r)
+		if err == nil {
+			err = user.resetPassword(password)
+			if err == errInvalidPasswordResetLink {
+				data.ValidToken = false
+			} else if err != nil {
 				log.Println(err)
 				http.Error(w, "Internal server error", 500)
 				return
 			}
-			// Send a mail to the user with the password, before attempting to update it
-			err = user.sendMail("Password reset", "Hi "+user.Username+". Someone (hopefully you) requested "+
-				"a new password for you on Moss Tier. Here's your new one: "+newPassword)
-			if err != nil {
-				errorString += "Could not send you an email with your new password."
-				log.Println(err)
-			} else {
-				err = user.updatePassword(newPassword)
-				if err != nil {
-					errorString += "Could not update your password due to an unexpected error. "
-					log.Println(err)
-				} else {
-					passwordReset = true
-				}
-			}
+		}
+		if err != nil {
+			data.Error = err.Error()
+		} else {
+			data.PasswordReset = true
 		}
 	}
-	renderContent("tmpl/passwordreset.html", r, w, passwordResetData{passwordReset, errorString})
+	renderContent("tmpl/passwordresettoken.html", r, w, data)
 }
 
 // profileHandler handles GET requests to "/profile*"
@@ -304,24 +774,90 @@ func profileHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Internal server error", 500)
 		return
 	}
+	// The personal best history contains, for each category with more than
+	// one run, the current run and all runs it superseded, oldest first.
+	type categoryHistory struct {
+		Category category
+		Runs     []run
+	}
 	type profileData struct {
 		Runner      *runner
 		Runs        []run
+		PendingRuns []run
 		FlaggedRuns []run
+		History     []categoryHistory
+		Dailies     []dailyEntry
+		// Standing is nil for runners without runs on the leaderboards.
+		Standing *runnerStanding
 	}
 	unflaggedRuns := []run{}
+	pendingRuns := []run{}
 	flaggedRuns := []run{}
+	history := []categoryHistory{}
 	for _, run := range allRuns {
 		if run.Flag != "" {
 			flaggedRuns = append(flaggedRuns, run)
-		} else {
+			continue
+		} else if run.Pending {
+			pendingRuns = append(pendingRuns, run)
+			continue
+		} else if !run.IsObsolete() {
 			unflaggedRuns = append(unflaggedRuns, run)
 		}
+		// Runs are ordered by category, so we only need to look at the
+		// latest category seen.
+		if len(history) == 0 || history[len(history)-1].Category.ID != run.Category.ID {
+			history = append(history, categoryHistory{run.Category, nil})
+		}
+		history[len(history)-1].Runs = append(history[len(history)-1].Runs, run)
+	}
+	multipleRunHistory := []categoryHistory{}
+	for _, h := range history {
+		if len(h.Runs) > 1 {
+			multipleRunHistory = append(multipleRunHistory, h)
+		}
 	}
-	data := profileData{&thisRunner, unflaggedRuns, flaggedRuns}
+	dailies, err := getDailyEntriesByRunner(thisRunner, 30)
+	if err != nil {
+		log.Println("Could not get daily entries: ", err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	var standing *runnerStanding
+	if s, err := getRunnerStanding(thisRunner.ID); err == nil {
+		standing = &s
+	} else if err != errNotRanked {
+		log.Println("Could not get standing: ", err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	data := profileData{&thisRunner, unflaggedRuns, pendingRuns, flaggedRuns, multipleRunHistory, dailies, standing}
 	renderContent("tmpl/profile.html", r, w, data)
 }
 
+// rankingsHandler handles GET requests to "/rankings", which ranks runners
+// across all categories, or across the categories in the class given by
+// "?class=main" or "?class=challenge".
+func rankingsHandler(w http.ResponseWriter, r *http.Request) {
+	class := r.URL.Query().Get("class")
+	if class != "" && class != rankingClassMain && class != rankingClassChallenge {
+		http.NotFound(w, r)
+		return
+	}
+	standings, err := getRunnerStandings(class)
+	if err != nil {
+		log.Println("Could not get rankings: ", err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	type rankingsData struct {
+		Class             string
+		Standings         []runnerStanding
+		PointsDescription string
+	}
+	renderContent("tmpl/rankings.html", r, w, rankingsData{class, standings, describePoints()})
+}
+
 // registerHandler handles GET and POST requests to "/register"
 func registerHandler(w http.ResponseWriter, r *http.Request) {
 	type registerData struct {
@@ -357,12 +893,19 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 					http.Error(w, "Internal server error", 500)
 					return
 				}
-				err = setActiveUser(r, w, user)
+				err = setActiveUser(r, w, user, false)
 				if err != nil {
 					log.Println(err)
 					http.Error(w, "Internal server error", 500)
 					return
 				}
+				if user.Email != "" {
+					emailVerificationsByAccount.allow(strconv.Itoa(user.ID))
+					err = user.requestEmailVerification()
+					if err != nil {
+						log.Println("Could not send email verification link: ", err)
+					}
+				}
 				success = true
 			}
 		}
@@ -402,12 +945,7 @@ func reportHandler(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			errorString = err.Error()
 		} else {
-			moderatorEmails := []string{}
-			for _, moderatorID := range config.Moderators {
-				moderator, _ := getRunnerByID(moderatorID)
-				moderatorEmails = append(moderatorEmails, moderator.Email)
-			}
-			err = sendMails(moderatorEmails, "Moss Tier run reported",
+			err = sendMails(getModeratorEmails(run.Category), "Moss Tier run reported",
 				"Hi Moss Tier moderator. The run by "+run.Runner.Username+" in the "+
 					"category "+run.Category.Name+" (id "+strconv.Itoa(runID)+") "+
 					"has been reported as violating the rules. Could you check it "+
@@ -430,21 +968,108 @@ func rulesHandler(w http.ResponseWriter, r *http.Request) {
 	renderContent("tmpl/rules.html", r, w, getAllCategories())
 }
 
-// submitRunHandler handles GET requests to "/submit-run/*". If a
+// submitRunHandler handles GET and POST requests to "/submit-run/*". If a
 // runID is given in the request, pre-fill the form with the info
 // of that run.
 func submitRunHandler(w http.ResponseWriter, r *http.Request) {
+	activeUser, err := getActiveUser(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
 	type submitRunData struct {
+		Success        bool
+		Error          string
 		Categories     []category
 		Spelunkers     []spelunker
+		Platforms      []platform
 		OldRun         *run
 		PossibleWorlds []int
 		PossibleLevels []int
 	}
-	vars := mux.Vars(r)
-	oldRunID, _ := strconv.Atoi(vars["runID"])
-	oldRun, _ := getRunByID(oldRunID)
-	data := submitRunData{getAllCategories(), spelunkers, &oldRun,
-		[]int{1, 2, 3, 4, 5}, []int{1, 2, 3, 4}}
+	success := false
+	var errorString string
+	var oldRun run
+
+	if r.Method == "POST" {
+		// In case of errors, we fill out the form with the data
+		// the user just gave us.
+		oldRun, err = submitRunFormParser(r, activeUser)
+		if err != nil {
+			errorString = err.Error()
+		} else {
+			err = oldRun.submit()
+			if err != nil {
+				errorString += "Could not submit run. Please try again later. "
+				log.Println(err)
+			} else {
+				success = true
+			}
+		}
+	} else {
+		vars := mux.Vars(r)
+		oldRunID, _ := strconv.Atoi(vars["runID"])
+		oldRun, _ = getRunByID(oldRunID)
+	}
+	data := submitRunData{success, errorString, getAllCategories(), spelunkers,
+		platforms, &oldRun, []int{1, 2, 3, 4, 5}, []int{1, 2, 3, 4}}
 	renderContent("tmpl/submitrun.html", r, w, data)
 }
+
+// verifyEmailHandler handles GET requests to "/verify-email/{token}", the
+// links verifying email addresses, and POST requests to "/verify-email",
+// where runners ask for a new link.
+func verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	type verifyEmailData struct {
+		Verified bool
+		Resent   bool
+		Email    string
+		Error    string
+	}
+	var data verifyEmailData
+	if token, ok := mux.Vars(r)["token"]; ok {
+		user, err := verifyEmail(token)
+		if err == errInvalidEmailVerificationLink {
+			data.Error = err.Error()
+		} else if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal server error", 500)
+			return
+		} else {
+			data.Verified = true
+			data.Email = user.Email
+		}
+		renderContent("tmpl/verifyemail.html", r, w, data)
+		return
+	}
+	user, err := getActiveUser(r)
+	if err != nil || r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+	r.ParseForm()
+	err = checkCSRFToken(r)
+	if err == nil && user.Email == "" {
+		err = errors.New("You have not given an email address.")
+	}
+	if err == nil && user.EmailVerified {
+		err = errors.New("Your email address is already verified.")
+	}
+	if err == nil && !emailVerificationsByAccount.allow(strconv.Itoa(user.ID)) {
+		err = errTooManyEmailVerifications
+	}
+	if err == nil {
+		err = user.requestEmailVerification()
+		if err != nil {
+			log.Println("Could not send email verification link: ", err)
+			err = errors.New("Could not send you a mail. Please try again later.")
+		}
+	}
+	if err != nil {
+		data.Error = err.Error()
+	} else {
+		data.Resent = true
+		data.Email = user.Email
+	}
+	renderContent("tmpl/verifyemail.html", r, w, data)
+}
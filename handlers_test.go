@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotFoundHandlerKeepsCSRFToken(t *testing.T) {
+	err := initializeTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = initializeCookieStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	notFoundHandler(w, httptest.NewRequest("GET", "/no-such-page", nil))
+	if w.Code != 404 {
+		t.Errorf("got status %d, want 404", w.Code)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("no session cookie was set")
+	}
+
+	// The session in the cookie must already hold a token, so that forms
+	// rendered on the page can be posted.
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	if token := getCSRFToken(r, w); token == "" || len(w.Result().Cookies()) != 0 {
+		t.Error("the session cookie holds no CSRF token")
+	}
+}
@@ -2,70 +2,223 @@ package main
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 )
 
-// Login sessions are handled using a single cookie store. Keys
-// are updated on a per-server launch basis.
+// Login sessions are stored in the database, and the cookie of a logged in
+// user only contains the ID of their session. The cookie is signed and
+// encrypted with the keys in the config, so that sessions survive restarts.
 var cookieStore *sessions.CookieStore
 
-func initializeCookieStore() {
-	cookieStore = sessions.NewCookieStore([]byte("hest"))
+// A sessionKeyPair is a pair of keys used for session cookies, given in
+// base64. The signing key should be 32 or 64 bytes long, and the encryption
+// key 16, 24 or 32 bytes.
+type sessionKeyPair struct {
+	SigningKey    string `json:"signingKey"`
+	EncryptionKey string `json:"encryptionKey"`
+}
+
+const (
+	defaultSessionHours   = 24
+	defaultRememberMeDays = 30
+)
+
+// initializeCookieStore sets up the cookie store using the keys in the
+// config. The first pair of keys is used for new cookies, and all pairs
+// are used to read cookies; to rotate the keys, add a new pair at the top,
+// and remove the old pair once the sessions using it have expired. If no
+// keys are given, random keys are used, logging everybody out on restarts.
+func initializeCookieStore() error {
+	var keys [][]byte
+	for _, pair := range config.SessionKeys {
+		signingKey, err := base64.StdEncoding.DecodeString(pair.SigningKey)
+		if err != nil || (len(signingKey) != 32 && len(signingKey) != 64) {
+			return errors.New("signing keys must be 32 or 64 bytes, given in base64")
+		}
+		encryptionKey, err := base64.StdEncoding.DecodeString(pair.EncryptionKey)
+		if err != nil || (len(encryptionKey) != 16 && len(encryptionKey) != 24 && len(encryptionKey) != 32) {
+			return errors.New("encryption keys must be 16, 24 or 32 bytes, given in base64")
+		}
+		keys = append(keys, signingKey, encryptionKey)
+	}
+	if len(keys) == 0 {
+		log.Println("No session keys in config; using random keys until restart.")
+		keys = [][]byte{securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32)}
+	}
+	cookieStore = sessions.NewCookieStore(keys...)
 
-	//cookieStore = sessions.NewCookieStore(securecookie.GenerateRandomKey(64),
-	//	securecookie.GenerateRandomKey(32))
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(config.CookieSameSite) {
+	case "", "lax":
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	default:
+		return errors.New("cookieSameSite must be one of \"lax\", \"strict\" and \"none\"")
+	}
 	cookieStore.Options = &sessions.Options{
 		Path:     "/",
 		MaxAge:   0, // Lasts until end of session
 		HttpOnly: true,
+		Secure:   config.SecureCookies,
+		SameSite: sameSite,
+	}
+	return nil
+}
+
+// sessionLifetime returns for how long a new session lasts, depending
+// on whether the user wants to be remembered.
+func sessionLifetime(remember bool) time.Duration {
+	if remember {
+		days := config.RememberMeDays
+		if days <= 0 {
+			days = defaultRememberMeDays
+		}
+		return time.Duration(days) * 24 * time.Hour
+	}
+	hours := config.SessionHours
+	if hours <= 0 {
+		hours = defaultSessionHours
 	}
+	return time.Duration(hours) * time.Hour
+}
+
+// hashToken returns the form in which a session ID or similar token is kept
+// in the database, so that the contents of the database can not be used to
+// log in.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// getSessionID returns the ID of the session in the cookie of a request.
+func getSessionID(r *http.Request) (string, error) {
+	session, err := cookieStore.Get(r, "login")
+	if err != nil {
+		return "", err
+	}
+	sessionID, ok := session.Values["sessionID"].(string)
+	if !ok || sessionID == "" {
+		return "", errors.New("no session ID found in cookie")
+	}
+	return sessionID, nil
 }
 
 // getActiveUser returns the currently logged in user, if any.
 func getActiveUser(r *http.Request) (user runner, err error) {
-	session, err := cookieStore.Get(r, "login")
+	sessionID, err := getSessionID(r)
 	if err != nil {
 		return
 	}
-	storedRunnerID, ok := session.Values["userID"]
-	if !ok {
-		err = errors.New("no user ID found in cookie")
+	runnerID, expires, err := db.getSession(hashToken(sessionID))
+	if err != nil {
 		return
 	}
-	// Session values are map[string]interface{}, so we need to
-	// cast and check the type.
-	runnerID, ok := storedRunnerID.(int)
-	if !ok {
-		err = errors.New("user ID was not an integer")
+	if time.Now().After(expires) {
+		err = errors.New("session has expired")
 		return
 	}
 	user, err = getRunnerByID(runnerID)
 	return
 }
 
-// setActiveUser sets the currently logged in user.
-func setActiveUser(r *http.Request, w http.ResponseWriter, user runner) (err error) {
-	session, err := cookieStore.Get(r, "login")
+// setActiveUser logs in a given user by starting a new session. If remember
+// is true, the session outlives the browser session.
+func setActiveUser(r *http.Request, w http.ResponseWriter, user runner, remember bool) (err error) {
+	// Any cookie we can not read, say because of rotated keys, is replaced.
+	session, _ := cookieStore.Get(r, "login")
+	sessionID, err := randomToken()
 	if err != nil {
 		return
 	}
-	session.Values["userID"] = user.ID
-	session.Save(r, w)
-	return
+	// Logging in also gives a new CSRF token, so that tokens seen before
+	// logging in are useless afterwards.
+	csrfToken, err := randomToken()
+	if err != nil {
+		return
+	}
+	lifetime := sessionLifetime(remember)
+	err = db.createSession(hashToken(sessionID), user.ID, time.Now().Add(lifetime))
+	if err != nil {
+		return
+	}
+	// This is as good a time as any to clean up.
+	err = db.deleteExpiredSessions()
+	if err != nil {
+		log.Println("Could not delete expired sessions: ", err)
+	}
+	session.Values = map[interface{}]interface{}{"sessionID": sessionID, "csrfToken": csrfToken}
+	session.Options.MaxAge = 0
+	if remember {
+		session.Options.MaxAge = int(lifetime.Seconds())
+	}
+	return session.Save(r, w)
+}
+
+// logOut ends the current session, if any. If everywhere is true, all
+// other sessions of the logged in user are ended as well.
+func logOut(r *http.Request, w http.ResponseWriter, everywhere bool) error {
+	if everywhere {
+		user, err := getActiveUser(r)
+		if err == nil {
+			err = db.deleteSessionsByRunner(user.ID, "")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	sessionID, err := getSessionID(r)
+	if err == nil {
+		err = db.deleteSession(hashToken(sessionID))
+		if err != nil {
+			return err
+		}
+	}
+	session, _ := cookieStore.Get(r, "login")
+	session.Values = map[interface{}]interface{}{}
+	session.Options.MaxAge = -1
+	return session.Save(r, w)
+}
+
+// endOtherSessions ends all sessions of a given user but the one of the
+// request, if any. This is used when passwords change.
+func endOtherSessions(r *http.Request, user runner) error {
+	var currentSession string
+	if sessionID, err := getSessionID(r); err == nil {
+		currentSession = hashToken(sessionID)
+	}
+	return db.deleteSessionsByRunner(user.ID, currentSession)
 }
 
-// generatePassword generates a 25 byte long random password.
-func generatePassword() (string, error) {
-	b := make([]byte, 25)
+// randomToken returns a random string suitable for session IDs and such.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
 	_, err := rand.Read(b)
 	if err != nil {
 		return "", err
 	}
-	// The slice should now contain random bytes instead of only zeroes.
-	// Base64 it just to have something users can use.
-	return base64.StdEncoding.EncodeToString(b), err
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// encodeLinkToken signs and encrypts a random ID with the session keys, for
+// use in links mailed to users. The name ties the token to its purpose.
+func encodeLinkToken(name, id string) (string, error) {
+	return securecookie.EncodeMulti(name, id, cookieStore.Codecs...)
+}
+
+// decodeLinkToken returns the random ID of a token made by encodeLinkToken.
+func decodeLinkToken(name, token string) (id string, err error) {
+	err = securecookie.DecodeMulti(name, token, &id, cookieStore.Codecs...)
+	return
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Failed attempts to log in are throttled both per IP address and per
+// account, so that the login form can not be used to guess passwords; as
+// bcrypt is slow by design, this also keeps it from being used to keep our
+// CPU busy. An IP address is allowed more failures than an account, as
+// several users may share an address.
+var (
+	loginFailuresByIP      = newBackoff(20, time.Minute, time.Hour)
+	loginFailuresByAccount = newBackoff(5, time.Minute, time.Hour)
+)
+
+var (
+	loginFailuresTotal = newCounter("mosstier_login_failures_total",
+		"Failed attempts to log in.")
+	loginBlockedByIPTotal = newCounter("mosstier_login_blocked_ip_total",
+		"Attempts to log in blocked because their IP address was locked out.")
+	loginBlockedByAccountTotal = newCounter("mosstier_login_blocked_account_total",
+		"Attempts to log in blocked because the account was locked out.")
+	loginLockoutsTotal = newCounter("mosstier_login_lockouts_total",
+		"Lockouts of IP addresses and accounts after failed attempts to log in.")
+)
+
+// All failed attempts give the same error, so that the login form does not
+// tell which usernames exist.
+var errIncorrectLogin = errors.New("Incorrect username or password.")
+
+// A loginLockedError is returned when an attempt to log in is blocked.
+type loginLockedError struct {
+	retryIn time.Duration
+}
+
+func (e loginLockedError) Error() string {
+	minutes := int((e.retryIn + time.Minute - 1) / time.Minute)
+	if minutes == 1 {
+		return "Too many failed attempts to log in. Please try again in a minute."
+	}
+	return fmt.Sprintf("Too many failed attempts to log in. Please try again in %d minutes.", minutes)
+}
+
+// checkLoginAllowed returns a loginLockedError if the IP address of a
+// request, or the account with a given username, is locked out.
+func checkLoginAllowed(r *http.Request, username string) error {
+	ipWait := loginFailuresByIP.lockedFor(clientIP(r))
+	accountWait := loginFailuresByAccount.lockedFor(strings.ToLower(username))
+	if ipWait == 0 && accountWait == 0 {
+		return nil
+	}
+	if ipWait > 0 {
+		loginBlockedByIPTotal.inc()
+	}
+	if accountWait > 0 {
+		loginBlockedByAccountTotal.inc()
+	}
+	if accountWait > ipWait {
+		return loginLockedError{accountWait}
+	}
+	return loginLockedError{ipWait}
+}
+
+// recordLoginFailure counts a failed attempt to log in with a given username.
+func recordLoginFailure(r *http.Request, username string) {
+	loginFailuresTotal.inc()
+	ip := clientIP(r)
+	if lockout := loginFailuresByIP.fail(ip); lockout > 0 {
+		loginLockoutsTotal.inc()
+		log.Printf("Locking out %s from logging in for %s.", ip, lockout)
+	}
+	if lockout := loginFailuresByAccount.fail(strings.ToLower(username)); lockout > 0 {
+		loginLockoutsTotal.inc()
+		log.Printf("Locking out account %s for %s.", username, lockout)
+	}
+}
+
+// recordLoginSuccess forgets the failed attempts to log in to an account.
+// Failures of the IP address are kept, or else an attacker could log in to
+// an account of their own between guesses.
+func recordLoginSuccess(username string) {
+	loginFailuresByAccount.reset(strings.ToLower(username))
+}
+
+var (
+	dummyPasswordHash     []byte
+	dummyPasswordHashOnce sync.Once
+)
+
+// spendLoginTime takes as long as checking a password, so that attempts to
+// log in to accounts that do not exist take as long as other attempts.
+func spendLoginTime(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), 12)
+	})
+	bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRecordLoginSuccess(t *testing.T) {
+	previousIP, previousAccount := loginFailuresByIP, loginFailuresByAccount
+	loginFailuresByIP = newBackoff(1, time.Minute, time.Hour)
+	loginFailuresByAccount = newBackoff(1, time.Minute, time.Hour)
+	defer func() { loginFailuresByIP, loginFailuresByAccount = previousIP, previousAccount }()
+
+	r := httptest.NewRequest("POST", "/login", nil)
+	for i := 0; i < 2; i++ {
+		recordLoginFailure(r, "Ana")
+	}
+	if _, ok := checkLoginAllowed(r, "ana").(loginLockedError); !ok {
+		t.Fatal("failures did not lock out the login")
+	}
+	// Usernames are not case sensitive.
+	recordLoginSuccess("ANA")
+	if wait := loginFailuresByAccount.lockedFor("ana"); wait != 0 {
+		t.Errorf("the account is still locked for %s", wait)
+	}
+	if loginFailuresByIP.lockedFor(clientIP(r)) == 0 {
+		t.Error("logging in unlocked the IP address")
+	}
+	if _, ok := checkLoginAllowed(r, "ana").(loginLockedError); !ok {
+		t.Error("the locked IP address may log in")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"html/template"
 	"log"
@@ -41,7 +42,10 @@ func renderContent(t string, r *http.Request, w http.ResponseWriter, data interf
 		ChallengeCategories []category
 		ActiveUser          *runner
 		UserLoggedIn        bool
-		PageContents        interface{}
+		// CSRFToken must be included in all forms posted to the site;
+		// see csrf.go.
+		CSRFToken    string
+		PageContents interface{}
 	}
 	user, err := getActiveUser(r)
 	loggedIn := err == nil
@@ -50,6 +54,7 @@ func renderContent(t string, r *http.Request, w http.ResponseWriter, data interf
 		getChallengeCategories(),
 		&user,
 		loggedIn,
+		getCSRFToken(r, w),
 		data}
 	err = templates[t].ExecuteTemplate(w, "base", templateDataVar)
 	if err != nil {
@@ -70,31 +75,62 @@ func initializeHandlers() {
 	router.NotFoundHandler = http.HandlerFunc(notFoundHandler)
 	router.HandleFunc("/", frontPageHandler)
 	router.HandleFunc("/about", aboutHandler)
+	router.HandleFunc("/admin/roles", adminRolesHandler)
+	router.HandleFunc("/api/v1/categories", apiCategoriesHandler).Methods("GET")
+	router.HandleFunc("/api/v1/categories/{categoryID:[0-9]+}/leaderboard", apiLeaderboardHandler).Methods("GET")
+	router.HandleFunc("/api/v1/platforms", apiPlatformsHandler).Methods("GET")
+	router.HandleFunc("/api/v1/runners/{runnerID:[0-9]+}", apiRunnerHandler).Methods("GET")
+	router.HandleFunc("/api/v1/runs/{runID:[0-9]+}", apiRunHandler).Methods("GET")
+	router.HandleFunc("/api/v1/spelunkers", apiSpelunkersHandler).Methods("GET")
+	router.HandleFunc("/api/v1/worldrecords", apiWorldRecordsHandler).Methods("GET")
+	router.HandleFunc("/appeal/{runID:[0-9]+}", appealHandler)
 	router.HandleFunc("/category/{categoryName:[a-z]+}", categoryHandler)
 	router.HandleFunc("/category/{categoryName:[a-z]+}/find/{runner:[0-9a-zA-Z_-]+}", categoryHandler)
+	router.HandleFunc("/category/{categoryName:[a-z]+}/history", categoryHistoryHandler)
 	router.HandleFunc("/contact", contactHandler)
+	router.HandleFunc("/countries", countriesHandler)
+	router.HandleFunc("/country/{countryCode:[a-zA-Z]{2}}", countryHandler)
+	router.HandleFunc("/daily", dailyHandler)
+	router.HandleFunc("/daily/{date:[0-9]{4}-[0-9]{2}-[0-9]{2}}", dailyHandler)
 	router.HandleFunc("/delete-run", deleteRunHandler)
 	router.HandleFunc("/edit-profile", editProfileHandler)
 	router.HandleFunc("/export", exportOverviewHandler)
 	router.HandleFunc("/export/all/{exportFormat:[a-z]+}", exportWrHandler)
+	router.HandleFunc("/export/countries/{exportFormat:[a-z]+}", exportCountriesHandler)
+	router.HandleFunc("/export/country/{countryCode:[a-zA-Z]{2}}/{exportFormat:[a-z]+}", exportCountryHandler)
 	router.HandleFunc("/export/{categoryID:[0-9]+}/{exportFormat:[a-z]+}", exportCategoryHandler)
+	router.HandleFunc("/export/{categoryID:[0-9]+}/history/json", exportHistoryHandler)
 	router.HandleFunc("/flag-run/{runID:[0-9]+}", flagRunHandler)
 	router.HandleFunc("/login", loginHandler)
 	router.HandleFunc("/log-out", logOutHandler)
+	router.HandleFunc("/moderation", moderationHandler)
+	router.HandleFunc("/moderation/log", moderationLogHandler)
 	router.HandleFunc("/password-reset", passwordResetHandler)
+	router.HandleFunc("/password-reset/{token:[0-9a-zA-Z_=-]+}", passwordResetTokenHandler)
 	router.HandleFunc("/profile/{profileID:[0-9]+}", profileHandler)
+	router.HandleFunc("/rankings", rankingsHandler)
 	router.HandleFunc("/register", registerHandler)
 	router.HandleFunc("/report/{runID:[0-9]+}", reportHandler)
 	router.HandleFunc("/rules", rulesHandler)
+	router.HandleFunc("/steam-callback", steamCallbackHandler).Methods("GET")
+	router.HandleFunc("/steam-link", steamLinkHandler)
+	router.HandleFunc("/steam-login", steamLoginHandler).Methods("GET")
 	router.HandleFunc("/steam-lookup", steamLookupHandler)
+	router.HandleFunc("/steam-unlink", steamUnlinkHandler)
 	router.HandleFunc("/submit-run", submitRunHandler)
 	router.HandleFunc("/submit-run/{runID:[0-9]+}", submitRunHandler)
+	router.HandleFunc("/verify-email", verifyEmailHandler)
+	router.HandleFunc("/verify-email/{token:[0-9a-zA-Z_=-]+}", verifyEmailHandler)
 	http.Handle("/", router)
 }
 
 func main() {
+	migrate := flag.Bool("migrate", false, "apply pending database migrations and exit")
+	migrateStatus := flag.Bool("migrate-status", false, "show the state of the database migrations and exit")
+	newAdmin := flag.String("make-admin", "", "make the runner with the given username an admin and exit")
+	flag.Parse()
+
 	err := initializeTemplates()
-	initializeCookieStore()
 	if err != nil {
 		log.Fatal("Could not initialise templates: ", err)
 	}
@@ -102,18 +138,52 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	err = initializeCookieStore()
+	if err != nil {
+		log.Fatal("Could not initialise cookie store: ", err)
+	}
+	if *migrateStatus {
+		err = openDatabase()
+		if err == nil {
+			err = db.printMigrationStatus()
+		}
+		if err != nil {
+			log.Fatal("Could not read migration status: ", err)
+		}
+		return
+	}
 	err = initializeDatabase()
 	if err != nil {
 		log.Fatal("Could not initialise database: ", err)
 	}
+	err = importLegacyModerators()
+	if err != nil {
+		log.Fatal("Could not import moderators: ", err)
+	}
+	if *migrate {
+		log.Println("Database is up to date.")
+		return
+	}
+	if *newAdmin != "" {
+		err = makeAdmin(*newAdmin)
+		if err != nil {
+			log.Fatal("Could not make admin: ", err)
+		}
+		log.Println(*newAdmin + " is now an admin.")
+		return
+	}
 	readSpelunkerNames()
+	readPlatforms()
 	readCountries()
+	initializeSteamClient()
+	startDailyMirror()
 
 	initializeHandlers()
+	serveMetrics()
 
 	err = http.ListenAndServe(fmt.Sprintf(":%d", config.WebserverPort), nil)
 	if err != nil {
 		log.Fatal("ListenAndServe: ", err)
-		db.Close()
+		db.close()
 	}
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+// A counter is a metric that only ever goes up, like the number of blocked
+// attempts to log in. Counters are served in the Prometheus text format at
+// "/metrics" on config.MetricsAddress, if set.
+type counter struct {
+	name  string
+	help  string
+	value int64
+}
+
+var counters []*counter
+
+// newCounter creates and registers a counter. As counters are registered
+// while the package is initialised, no locking is needed.
+func newCounter(name, help string) *counter {
+	c := &counter{name: name, help: help}
+	counters = append(counters, c)
+	return c
+}
+
+// inc increases the counter by one.
+func (c *counter) inc() {
+	atomic.AddInt64(&c.value, 1)
+}
+
+// metricsHandler handles GET requests to "/metrics" on the metrics address.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, c := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n",
+			c.name, c.help, c.name, c.name, atomic.LoadInt64(&c.value))
+	}
+}
+
+// serveMetrics serves the metrics on config.MetricsAddress, which should not
+// be reachable from the outside, as the metrics are not for everybody.
+func serveMetrics() {
+	if config.MetricsAddress == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler)
+	go func() {
+		err := http.ListenAndServe(config.MetricsAddress, mux)
+		if err != nil {
+			log.Println("Could not serve metrics: ", err)
+		}
+	}()
+}
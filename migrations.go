@@ -0,0 +1,397 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// A migration takes the database schema from version Version-1 to
+// version Version. The statements are executed one at a time, in order.
+type migration struct {
+	Version     int
+	Description string
+	Statements  []string
+}
+
+// mysqlMigrations contains every change ever made to the MySQL schema, ordered
+// by version. Migrations must never be changed once released; to change the
+// schema, add a new migration at the end of both this and sqliteMigrations,
+// using the same version number.
+var mysqlMigrations = []migration{
+	{1, "Initial schema", []string{
+		`CREATE TABLE IF NOT EXISTS newWR (
+			id int(11) NOT NULL AUTO_INCREMENT,
+			runid int(11) NOT NULL,
+			PRIMARY KEY (id)
+		) ENGINE=MyISAM DEFAULT CHARSET=latin1`,
+		`CREATE TABLE IF NOT EXISTS runs (
+			id int(11) NOT NULL AUTO_INCREMENT,
+			runner int(11) NOT NULL,
+			cat int(11) NOT NULL,
+			score int(11) NOT NULL,
+			level int(11) NOT NULL,
+			link varchar(100) NOT NULL,
+			platform int(11) NOT NULL,
+			spelunker int(11) NOT NULL,
+			date int(11) NOT NULL,
+			comment varchar(150) NOT NULL,
+			flag varchar(100) NOT NULL,
+			PRIMARY KEY (id)
+		) ENGINE=MyISAM DEFAULT CHARSET=latin1`,
+		`CREATE TABLE IF NOT EXISTS users (
+			id int(11) NOT NULL AUTO_INCREMENT,
+			username varchar(25) CHARACTER SET utf8 NOT NULL,
+			pass varchar(255) NOT NULL,
+			email varchar(40) NOT NULL,
+			country varchar(11) NOT NULL,
+			spelunker int(11) NOT NULL,
+			steam bigint(20) NOT NULL,
+			psn varchar(25) NOT NULL,
+			xbla varchar(25) NOT NULL,
+			twitch varchar(25) NOT NULL,
+			youtube varchar(25) NOT NULL,
+			freetext varchar(1000) NOT NULL,
+			emailflag int(11) NOT NULL,
+			emailwr int(11) NOT NULL,
+			emailChallenge int(11) NOT NULL,
+			PRIMARY KEY (id)
+		) ENGINE=MyISAM DEFAULT CHARSET=latin1`,
+	}},
+	// Submitting a run replaces the old one in a transaction, which
+	// MyISAM silently ignores.
+	{2, "Use a transactional storage engine", []string{
+		"ALTER TABLE newWR ENGINE=InnoDB",
+		"ALTER TABLE runs ENGINE=InnoDB",
+		"ALTER TABLE users ENGINE=InnoDB",
+	}},
+	// makeUser only sets username, email and password, which fails in
+	// strict mode unless the remaining columns have defaults.
+	{3, "Add defaults to optional columns", []string{
+		`ALTER TABLE users
+			MODIFY country varchar(11) NOT NULL DEFAULT '',
+			MODIFY spelunker int(11) NOT NULL DEFAULT 0,
+			MODIFY steam bigint(20) NOT NULL DEFAULT 0,
+			MODIFY psn varchar(25) NOT NULL DEFAULT '',
+			MODIFY xbla varchar(25) NOT NULL DEFAULT '',
+			MODIFY twitch varchar(25) NOT NULL DEFAULT '',
+			MODIFY youtube varchar(25) NOT NULL DEFAULT '',
+			MODIFY freetext varchar(1000) NOT NULL DEFAULT '',
+			MODIFY emailflag int(11) NOT NULL DEFAULT 0,
+			MODIFY emailwr int(11) NOT NULL DEFAULT 0,
+			MODIFY emailChallenge int(11) NOT NULL DEFAULT 0`,
+		"ALTER TABLE runs MODIFY flag varchar(100) NOT NULL DEFAULT ''",
+	}},
+	{4, "Add review state of runs", []string{
+		"ALTER TABLE runs ADD COLUMN pending int(11) NOT NULL DEFAULT 0",
+	}},
+	{5, "Keep superseded runs", []string{
+		"ALTER TABLE runs ADD COLUMN obsoleted int(11) NOT NULL DEFAULT 0",
+	}},
+	{6, "Add appeals against flags", []string{
+		"ALTER TABLE runs ADD COLUMN appeal varchar(500) NOT NULL DEFAULT ''",
+		"ALTER TABLE runs ADD COLUMN appealed int(11) NOT NULL DEFAULT 0",
+		"ALTER TABLE runs ADD COLUMN appealDismissed int(11) NOT NULL DEFAULT 0",
+	}},
+	{7, "Add audit log", []string{
+		`CREATE TABLE auditlog (
+			id int(11) NOT NULL AUTO_INCREMENT,
+			actor int(11) NOT NULL,
+			action varchar(20) NOT NULL,
+			run int(11) NOT NULL DEFAULT 0,
+			runner int(11) NOT NULL DEFAULT 0,
+			cat int(11) NOT NULL DEFAULT 0,
+			reason varchar(1000) NOT NULL DEFAULT '',
+			date int(11) NOT NULL,
+			PRIMARY KEY (id),
+			KEY actor (actor),
+			KEY date (date)
+		) ENGINE=InnoDB DEFAULT CHARSET=latin1`,
+	}},
+	{8, "Add roles of runners", []string{
+		"ALTER TABLE users ADD COLUMN role varchar(10) NOT NULL DEFAULT 'runner'",
+		`CREATE TABLE moderatorscopes (
+			runner int(11) NOT NULL,
+			cat int(11) NOT NULL,
+			PRIMARY KEY (runner, cat)
+		) ENGINE=InnoDB DEFAULT CHARSET=latin1`,
+	}},
+	{9, "Add login sessions", []string{
+		`CREATE TABLE sessions (
+			id char(64) NOT NULL,
+			runner int(11) NOT NULL,
+			created int(11) NOT NULL,
+			expires int(11) NOT NULL,
+			PRIMARY KEY (id),
+			KEY runner (runner)
+		) ENGINE=InnoDB DEFAULT CHARSET=latin1`,
+	}},
+	{10, "Add password reset links", []string{
+		`CREATE TABLE passwordresets (
+			id char(64) NOT NULL,
+			runner int(11) NOT NULL,
+			created int(11) NOT NULL,
+			expires int(11) NOT NULL,
+			PRIMARY KEY (id),
+			KEY runner (runner)
+		) ENGINE=InnoDB DEFAULT CHARSET=latin1`,
+	}},
+	{11, "Add email verification", []string{
+		"ALTER TABLE users ADD COLUMN emailVerified int(1) NOT NULL DEFAULT 0",
+		// Addresses from before verification existed are trusted.
+		"UPDATE users SET emailVerified = 1 WHERE email != ''",
+		`CREATE TABLE emailverifications (
+			id char(64) NOT NULL,
+			runner int(11) NOT NULL,
+			email varchar(40) NOT NULL,
+			created int(11) NOT NULL,
+			expires int(11) NOT NULL,
+			PRIMARY KEY (id),
+			KEY runner (runner)
+		) ENGINE=InnoDB DEFAULT CHARSET=latin1`,
+	}},
+	{12, "Add verified Steam accounts", []string{
+		"ALTER TABLE users ADD COLUMN steamVerified int(1) NOT NULL DEFAULT 0",
+	}},
+	{13, "Add daily challenge mirror", []string{
+		`CREATE TABLE dailies (
+			date char(10) NOT NULL,
+			leaderboard int(11) NOT NULL,
+			entries int(11) NOT NULL,
+			fetched int(11) NOT NULL,
+			PRIMARY KEY (date)
+		) ENGINE=InnoDB DEFAULT CHARSET=latin1`,
+		`CREATE TABLE dailyentries (
+			date char(10) NOT NULL,
+			place int(11) NOT NULL,
+			steam bigint(20) NOT NULL,
+			score int(11) NOT NULL,
+			level int(11) NOT NULL,
+			spelunker int(11) NOT NULL,
+			PRIMARY KEY (date, steam),
+			KEY steam (steam)
+		) ENGINE=InnoDB DEFAULT CHARSET=latin1`,
+	}},
+	{14, "Record approval of runs", []string{
+		"ALTER TABLE runs ADD COLUMN approved int(11) NOT NULL DEFAULT 0",
+		"UPDATE runs SET approved = date WHERE pending = 0",
+	}},
+	{15, "Record imports of legacy settings", []string{
+		`CREATE TABLE legacyimports (
+			name varchar(40) NOT NULL,
+			imported int(11) NOT NULL,
+			PRIMARY KEY (name)
+		) ENGINE=InnoDB DEFAULT CHARSET=latin1`,
+	}},
+}
+
+// sqliteMigrations are the SQLite counterparts of mysqlMigrations. Note that
+// type names like int(11) are fine in SQLite, but AUTO_INCREMENT is not.
+var sqliteMigrations = []migration{
+	{1, "Initial schema", []string{
+		`CREATE TABLE IF NOT EXISTS newWR (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			runid int(11) NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			runner int(11) NOT NULL,
+			cat int(11) NOT NULL,
+			score int(11) NOT NULL,
+			level int(11) NOT NULL,
+			link varchar(100) NOT NULL,
+			platform int(11) NOT NULL,
+			spelunker int(11) NOT NULL,
+			date int(11) NOT NULL,
+			comment varchar(150) NOT NULL,
+			flag varchar(100) NOT NULL DEFAULT ''
+		)`,
+		// Usernames and emails are case insensitive in MySQL.
+		`CREATE TABLE IF NOT EXISTS users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username varchar(25) NOT NULL COLLATE NOCASE,
+			pass varchar(255) NOT NULL,
+			email varchar(40) NOT NULL COLLATE NOCASE,
+			country varchar(11) NOT NULL DEFAULT '',
+			spelunker int(11) NOT NULL DEFAULT 0,
+			steam bigint(20) NOT NULL DEFAULT 0,
+			psn varchar(25) NOT NULL DEFAULT '',
+			xbla varchar(25) NOT NULL DEFAULT '',
+			twitch varchar(25) NOT NULL DEFAULT '',
+			youtube varchar(25) NOT NULL DEFAULT '',
+			freetext varchar(1000) NOT NULL DEFAULT '',
+			emailflag int(11) NOT NULL DEFAULT 0,
+			emailwr int(11) NOT NULL DEFAULT 0,
+			emailChallenge int(11) NOT NULL DEFAULT 0
+		)`,
+	}},
+	// SQLite has no storage engines, and the defaults are in place already.
+	{2, "Use a transactional storage engine", nil},
+	{3, "Add defaults to optional columns", nil},
+	{4, "Add review state of runs", []string{
+		"ALTER TABLE runs ADD COLUMN pending int(11) NOT NULL DEFAULT 0",
+	}},
+	{5, "Keep superseded runs", []string{
+		"ALTER TABLE runs ADD COLUMN obsoleted int(11) NOT NULL DEFAULT 0",
+	}},
+	{6, "Add appeals against flags", []string{
+		"ALTER TABLE runs ADD COLUMN appeal varchar(500) NOT NULL DEFAULT ''",
+		"ALTER TABLE runs ADD COLUMN appealed int(11) NOT NULL DEFAULT 0",
+		"ALTER TABLE runs ADD COLUMN appealDismissed int(11) NOT NULL DEFAULT 0",
+	}},
+	{7, "Add audit log", []string{
+		`CREATE TABLE auditlog (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			actor int(11) NOT NULL,
+			action varchar(20) NOT NULL,
+			run int(11) NOT NULL DEFAULT 0,
+			runner int(11) NOT NULL DEFAULT 0,
+			cat int(11) NOT NULL DEFAULT 0,
+			reason varchar(1000) NOT NULL DEFAULT '',
+			date int(11) NOT NULL
+		)`,
+		"CREATE INDEX auditlog_actor ON auditlog (actor)",
+		"CREATE INDEX auditlog_date ON auditlog (date)",
+	}},
+	{8, "Add roles of runners", []string{
+		"ALTER TABLE users ADD COLUMN role varchar(10) NOT NULL DEFAULT 'runner'",
+		`CREATE TABLE moderatorscopes (
+			runner int(11) NOT NULL,
+			cat int(11) NOT NULL,
+			PRIMARY KEY (runner, cat)
+		)`,
+	}},
+	{9, "Add login sessions", []string{
+		`CREATE TABLE sessions (
+			id char(64) NOT NULL PRIMARY KEY,
+			runner int(11) NOT NULL,
+			created int(11) NOT NULL,
+			expires int(11) NOT NULL
+		)`,
+		"CREATE INDEX sessions_runner ON sessions (runner)",
+	}},
+	{10, "Add password reset links", []string{
+		`CREATE TABLE passwordresets (
+			id char(64) NOT NULL PRIMARY KEY,
+			runner int(11) NOT NULL,
+			created int(11) NOT NULL,
+			expires int(11) NOT NULL
+		)`,
+		"CREATE INDEX passwordresets_runner ON passwordresets (runner)",
+	}},
+	{11, "Add email verification", []string{
+		"ALTER TABLE users ADD COLUMN emailVerified int(1) NOT NULL DEFAULT 0",
+		"UPDATE users SET emailVerified = 1 WHERE email != ''",
+		`CREATE TABLE emailverifications (
+			id char(64) NOT NULL PRIMARY KEY,
+			runner int(11) NOT NULL,
+			email varchar(40) NOT NULL,
+			created int(11) NOT NULL,
+			expires int(11) NOT NULL
+		)`,
+		"CREATE INDEX emailverifications_runner ON emailverifications (runner)",
+	}},
+	{12, "Add verified Steam accounts", []string{
+		"ALTER TABLE users ADD COLUMN steamVerified int(1) NOT NULL DEFAULT 0",
+	}},
+	{13, "Add daily challenge mirror", []string{
+		`CREATE TABLE dailies (
+			date char(10) NOT NULL PRIMARY KEY,
+			leaderboard int(11) NOT NULL,
+			entries int(11) NOT NULL,
+			fetched int(11) NOT NULL
+		)`,
+		`CREATE TABLE dailyentries (
+			date char(10) NOT NULL,
+			place int(11) NOT NULL,
+			steam bigint(20) NOT NULL,
+			score int(11) NOT NULL,
+			level int(11) NOT NULL,
+			spelunker int(11) NOT NULL,
+			PRIMARY KEY (date, steam)
+		)`,
+		"CREATE INDEX dailyentries_steam ON dailyentries (steam)",
+	}},
+	{14, "Record approval of runs", []string{
+		"ALTER TABLE runs ADD COLUMN approved int(11) NOT NULL DEFAULT 0",
+		"UPDATE runs SET approved = date WHERE pending = 0",
+	}},
+	{15, "Record imports of legacy settings", []string{
+		`CREATE TABLE legacyimports (
+			name varchar(40) NOT NULL PRIMARY KEY,
+			imported int(11) NOT NULL
+		)`,
+	}},
+}
+
+// latestSchemaVersion returns the version of the schema this binary expects.
+func (s *sqlStore) latestSchemaVersion() int {
+	return s.migrations[len(s.migrations)-1].Version
+}
+
+// schemaVersion returns the version of the schema currently in the
+// database, creating the table keeping track of it if necessary. An empty
+// database has version 0.
+func (s *sqlStore) schemaVersion() (version int, err error) {
+	_, err = s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version int(11) NOT NULL PRIMARY KEY,
+		applied int(11) NOT NULL
+	)`)
+	if err != nil {
+		return
+	}
+	err = s.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return
+}
+
+// migrate applies all migrations not yet applied to the database. It
+// refuses to touch databases whose schema is newer than the one this
+// binary knows about.
+func (s *sqlStore) migrate() error {
+	version, err := s.schemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > s.latestSchemaVersion() {
+		return fmt.Errorf("database schema version %d is newer than the latest one known (%d); refusing to start",
+			version, s.latestSchemaVersion())
+	}
+	for _, m := range s.migrations {
+		if m.Version <= version {
+			continue
+		}
+		log.Printf("Migrating database to schema version %d: %s", m.Version, m.Description)
+		for _, statement := range m.Statements {
+			_, err = s.db.Exec(statement)
+			if err != nil {
+				return fmt.Errorf("migration %d failed: %s", m.Version, err)
+			}
+		}
+		_, err = s.db.Exec("INSERT INTO schema_version (version, applied) VALUES (?, ?)",
+			m.Version, time.Now().Unix())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printMigrationStatus prints the schema version of the database, and the
+// state of every migration known to the binary.
+func (s *sqlStore) printMigrationStatus() error {
+	version, err := s.schemaVersion()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Database schema version: %d (latest known: %d)\n", version, s.latestSchemaVersion())
+	for _, m := range s.migrations {
+		state := "pending"
+		var applied int64
+		err = s.db.QueryRow("SELECT applied FROM schema_version WHERE version = ?", m.Version).Scan(&applied)
+		if err == nil {
+			state = "applied " + time.Unix(applied, 0).Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%4d  %-24s  %s\n", m.Version, state, m.Description)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// Runners who forgot their password are mailed a link containing a random
+// token, which lets them choose a new password. The link is signed with the
+// session keys, while only a hash of the token is kept in the database; the
+// link expires after passwordResetLifetime, and can only be used once.
+const (
+	passwordResetLifetime  = time.Hour
+	passwordResetTokenName = "passwordReset"
+)
+
+// To keep people from flooding the inboxes of our users, each account and
+// each IP address can only request a few resets per hour.
+var (
+	passwordResetsByAccount = newRateLimiter(3, time.Hour)
+	passwordResetsByIP      = newRateLimiter(10, time.Hour)
+)
+
+var (
+	errInvalidPasswordResetLink = errors.New("This link is invalid or has expired. You can ask for a new one on the password reset page.")
+	errTooManyPasswordResets    = errors.New("Too many password resets have been requested. Please try again later.")
+)
+
+// requestPasswordReset mails the runner a link that lets them choose a new
+// password.
+func (r *runner) requestPasswordReset() error {
+	if r.Email == "" {
+		return errors.New("user has no email set")
+	}
+	id, err := randomToken()
+	if err != nil {
+		return err
+	}
+	token, err := encodeLinkToken(passwordResetTokenName, id)
+	if err != nil {
+		return err
+	}
+	err = db.createPasswordReset(hashToken(id), r.ID, time.Now().Add(passwordResetLifetime))
+	if err != nil {
+		return err
+	}
+	err = db.deleteExpiredPasswordResets()
+	if err != nil {
+		log.Println("Could not delete expired password resets: ", err)
+	}
+	return r.sendMail("Password reset", "Hi "+r.Username+". Someone (hopefully you) asked to "+
+		"reset your password on Moss Tier. To choose a new password, follow the link below "+
+		"within the next hour:\n\n"+siteURL()+"/password-reset/"+token+"\n\n"+
+		"If you did not ask for this, you can ignore this mail; your password has not changed.")
+}
+
+// getRunnerByPasswordResetToken returns the runner whom a given password reset
+// token belongs to, as long as the token is valid.
+func getRunnerByPasswordResetToken(token string) (runner, error) {
+	id, err := decodeLinkToken(passwordResetTokenName, token)
+	if err != nil {
+		return runner{}, errInvalidPasswordResetLink
+	}
+	runnerID, expires, err := db.getPasswordReset(hashToken(id))
+	if err != nil || time.Now().After(expires) {
+		return runner{}, errInvalidPasswordResetLink
+	}
+	user, err := getRunnerByID(runnerID)
+	if err != nil {
+		return runner{}, errInvalidPasswordResetLink
+	}
+	return user, nil
+}
+
+// resetPassword sets a new password for a runner who has followed a password
+// reset link. All their reset links and login sessions are invalidated.
+func (r *runner) resetPassword(password string) error {
+	// Deleting the links first makes sure that each link is used only once,
+	// even if it is posted twice at the same time.
+	deleted, err := db.deletePasswordResets(r.ID)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errInvalidPasswordResetLink
+	}
+	err = r.updatePassword(password)
+	if err != nil {
+		return err
+	}
+	logRunnerAction(*r, auditPasswordReset, *r, "")
+	return db.deleteSessionsByRunner(r.ID, "")
+}
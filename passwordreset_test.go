@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestSessionKeys signs links and sessions with given key pairs, each
+// made from a single letter, for the duration of a test.
+func useTestSessionKeys(t *testing.T, letters ...string) {
+	previous := config.SessionKeys
+	config.SessionKeys = nil
+	for _, letter := range letters {
+		config.SessionKeys = append(config.SessionKeys, sessionKeyPair{
+			SigningKey:    base64.StdEncoding.EncodeToString([]byte(strings.Repeat(letter, 32))),
+			EncryptionKey: base64.StdEncoding.EncodeToString([]byte(strings.Repeat(letter, 16))),
+		})
+	}
+	err := initializeCookieStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		config.SessionKeys = previous
+		initializeCookieStore()
+	})
+}
+
+// addTestPasswordReset stores a password reset link of a given runner,
+// expiring at a given time, and returns its token.
+func addTestPasswordReset(t *testing.T, r runner, expires time.Time) string {
+	id, err := randomToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := encodeLinkToken(passwordResetTokenName, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.createPasswordReset(hashToken(id), r.ID, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestPasswordResetOnce(t *testing.T) {
+	useTestStore(t)
+	useTestSessionKeys(t, "a")
+	ana := addTestRunner(t, "ana")
+	token := addTestPasswordReset(t, ana, time.Now().Add(passwordResetLifetime))
+	other := addTestPasswordReset(t, ana, time.Now().Add(passwordResetLifetime))
+
+	r, err := getRunnerByPasswordResetToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != ana.ID {
+		t.Fatalf("the link belongs to runner %d, want %d", r.ID, ana.ID)
+	}
+	err = r.resetPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both links are used up, and a reset racing with the first one finds
+	// nothing left to delete.
+	for _, used := range []string{token, other} {
+		_, err = getRunnerByPasswordResetToken(used)
+		if err != errInvalidPasswordResetLink {
+			t.Errorf("a used link gave %v, want %v", err, errInvalidPasswordResetLink)
+		}
+	}
+	deleted, err := db.deletePasswordResets(ana.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 0 {
+		t.Errorf("deleted %d links after a reset, want 0", deleted)
+	}
+	err = r.resetPassword("another password")
+	if err != errInvalidPasswordResetLink {
+		t.Errorf("resetting twice gave %v, want %v", err, errInvalidPasswordResetLink)
+	}
+	got, err := getRunnerByID(ana.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.testLogin("correct horse battery staple") != nil {
+		t.Error("the password set by the first reset was not kept")
+	}
+}
+
+func TestPasswordResetExpiry(t *testing.T) {
+	s := useTestStore(t)
+	useTestSessionKeys(t, "a")
+	ana := addTestRunner(t, "ana")
+	expired := addTestPasswordReset(t, ana, time.Now().Add(-time.Second))
+	_, err := getRunnerByPasswordResetToken(expired)
+	if err != errInvalidPasswordResetLink {
+		t.Errorf("an expired link gave %v, want %v", err, errInvalidPasswordResetLink)
+	}
+
+	valid := addTestPasswordReset(t, ana, time.Now().Add(time.Minute))
+	err = db.deleteExpiredPasswordResets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM passwordresets").Scan(&kept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept != 1 {
+		t.Errorf("kept %d links, want only the valid one", kept)
+	}
+	if _, err := getRunnerByPasswordResetToken(valid); err != nil {
+		t.Errorf("a valid link gave %v after deleting expired ones", err)
+	}
+}
+
+func TestPasswordResetKeyRotation(t *testing.T) {
+	useTestStore(t)
+	useTestSessionKeys(t, "a")
+	ana := addTestRunner(t, "ana")
+	token := addTestPasswordReset(t, ana, time.Now().Add(passwordResetLifetime))
+
+	tests := []struct {
+		name  string
+		keys  []string
+		valid bool
+	}{
+		{"old key kept", []string{"b", "a"}, true},
+		{"old key dropped", []string{"b"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestSessionKeys(t, test.keys...)
+			r, err := getRunnerByPasswordResetToken(token)
+			if !test.valid {
+				if err != errInvalidPasswordResetLink {
+					t.Errorf("got runner %d, %v, want %v", r.ID, err, errInvalidPasswordResetLink)
+				}
+				return
+			}
+			if err != nil || r.ID != ana.ID {
+				t.Errorf("got runner %d, %v, want %d", r.ID, err, ana.ID)
+			}
+		})
+	}
+
+	// Links signed by the newest key are fine too.
+	useTestSessionKeys(t, "b", "a")
+	token = addTestPasswordReset(t, ana, time.Now().Add(passwordResetLifetime))
+	if r, err := getRunnerByPasswordResetToken(token); err != nil || r.ID != ana.ID {
+		t.Errorf("a link signed with the new key gave runner %d, %v", r.ID, err)
+	}
+}
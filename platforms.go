@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+)
+
+// A platform is a system Spelunky is played on. Runs are stored with the ID
+// of their platform, so IDs in data/platforms.json must never change; the
+// abbreviation is used in addresses.
+type platform struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Abbr string `json:"abbr"`
+}
+
+var platforms []platform
+
+// readPlatforms reads all platforms into `platforms`
+func readPlatforms() {
+	if platforms != nil {
+		return
+	}
+	platformFile, _ := ioutil.ReadFile("data/platforms.json")
+	json.Unmarshal(platformFile, &platforms)
+}
+
+func getPlatformByID(id int) (platform, error) {
+	for _, platform := range platforms {
+		if platform.ID == id {
+			return platform, nil
+		}
+	}
+	return platform{}, errors.New("No platform with given id.")
+}
+
+func getPlatformByAbbr(abbr string) (platform, error) {
+	for _, platform := range platforms {
+		if platform.Abbr == abbr {
+			return platform, nil
+		}
+	}
+	return platform{}, errors.New("No platform with given abbreviation.")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Runs earn points for their runners, and the countries of those, by how
+// they compare to the other runs in their category. There are two formulas:
+// with "rank", the default, a world record is worth MaxPoints points, second
+// place one point less, and so on down to a single point; runs further down
+// are worth nothing. With "relative", runs are worth MaxPoints times their
+// result relative to the world record, so a run taking twice as long as the
+// world record is worth half as much.
+type pointsConfig struct {
+	Formula   string `json:"formula"`
+	MaxPoints int    `json:"maxPoints"`
+}
+
+const (
+	pointsFormulaRank     = "rank"
+	pointsFormulaRelative = "relative"
+	defaultMaxPoints      = 100
+)
+
+// pointsFormula returns the configured points formula.
+func pointsFormula() string {
+	if config.Points.Formula == "" {
+		return pointsFormulaRank
+	}
+	return config.Points.Formula
+}
+
+// maxPoints returns the points of a world record.
+func maxPoints() int {
+	if config.Points.MaxPoints <= 0 {
+		return defaultMaxPoints
+	}
+	return config.Points.MaxPoints
+}
+
+// runPoints returns the points earned by a ranked run, given the world
+// record in its category.
+func runPoints(r run, record run) int {
+	if pointsFormula() == pointsFormulaRelative {
+		if r.Score <= 0 || record.Score <= 0 {
+			return 0
+		}
+		ratio := float64(record.Score) / float64(r.Score)
+		if r.Category.Goal == "Score" {
+			ratio = float64(r.Score) / float64(record.Score)
+		}
+		return int(math.Round(float64(maxPoints()) * math.Min(ratio, 1)))
+	}
+	if r.RankInCategory < 1 || r.RankInCategory > maxPoints() {
+		return 0
+	}
+	return maxPoints() + 1 - r.RankInCategory
+}
+
+// describePoints explains the points formula to humans.
+func describePoints() string {
+	if pointsFormula() == pointsFormulaRelative {
+		return fmt.Sprintf("Each run earns up to %d points, relative to the world record in its "+
+			"category: a world record earns %d points, and a run with half the score, or taking "+
+			"twice the time, earns half as many.", maxPoints(), maxPoints())
+	}
+	return fmt.Sprintf("Each run earns points by its rank in its category: %d points for a world "+
+		"record, %d for second place, and so on down to 1 point for place %d.",
+		maxPoints(), maxPoints()-1, maxPoints())
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Runners are ranked across categories by the points of their current runs;
+// see points.go. Main and challenge categories are totalled separately, so
+// that either can be ranked on its own.
+
+// The classes of categories rankings can be limited to.
+const (
+	rankingClassMain      = "main"
+	rankingClassChallenge = "challenge"
+)
+
+// A runnerStanding sums up the current runs of a runner.
+type runnerStanding struct {
+	Rank            int
+	Runner          runner
+	Runs            int
+	WorldRecords    int
+	MainPoints      int
+	ChallengePoints int
+}
+
+var errNotRanked = errors.New("Runner has no runs on the leaderboards.")
+
+// TotalPoints returns the points of the runner in all categories.
+func (s *runnerStanding) TotalPoints() int {
+	return s.MainPoints + s.ChallengePoints
+}
+
+// points returns the points of the runner in a given class of categories,
+// or in all categories if the class is empty.
+func (s *runnerStanding) points(class string) int {
+	switch class {
+	case rankingClassMain:
+		return s.MainPoints
+	case rankingClassChallenge:
+		return s.ChallengePoints
+	}
+	return s.TotalPoints()
+}
+
+// getRunnerStandings returns the standings of all runners with runs on the
+// leaderboards, ranked by their points in a given class of categories, or in
+// all categories if the class is empty. Runners without points in the class
+// are left out.
+func getRunnerStandings(class string) ([]runnerStanding, error) {
+	allRuns, err := getCurrentRunsByCategory()
+	if err != nil {
+		return nil, err
+	}
+	standings := make(map[int]*runnerStanding)
+	for _, runs := range allRuns {
+		for _, r := range runs {
+			standing := standings[r.Runner.ID]
+			if standing == nil {
+				standing = &runnerStanding{Runner: r.Runner}
+				standings[r.Runner.ID] = standing
+			}
+			points := runPoints(r, runs[0])
+			if r.Category.isMain() {
+				standing.MainPoints += points
+			} else {
+				standing.ChallengePoints += points
+			}
+			standing.Runs++
+			if r.IsWorldRecord() {
+				standing.WorldRecords++
+			}
+		}
+	}
+	result := []runnerStanding{}
+	for _, standing := range standings {
+		if class == "" || standing.points(class) > 0 {
+			result = append(result, *standing)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.points(class) != b.points(class) {
+			return a.points(class) > b.points(class)
+		}
+		return strings.ToLower(a.Runner.Username) < strings.ToLower(b.Runner.Username)
+	})
+	ranks := sharedRanks(len(result), func(i, j int) bool {
+		return result[i].points(class) == result[j].points(class)
+	})
+	for i := range result {
+		result[i].Rank = ranks[i]
+	}
+	return result, nil
+}
+
+// getRunnerStanding returns the overall standing of the runner with a given
+// ID, or errNotRanked if they have no runs on the leaderboards.
+func getRunnerStanding(runnerID int) (runnerStanding, error) {
+	standings, err := getRunnerStandings("")
+	if err != nil {
+		return runnerStanding{}, err
+	}
+	for _, standing := range standings {
+		if standing.Runner.ID == runnerID {
+			return standing, nil
+		}
+	}
+	return runnerStanding{}, errNotRanked
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetRunnerStandings(t *testing.T) {
+	_, ana, bob, cid, dan := addRankingRuns(t)
+	// With 10 points for a record, ana has 10 for score and 10 for the
+	// challenge, bob 10 for score, cid 8 for score and 10 for any%, and
+	// dan 9 for any% and 9 for the challenge.
+	tests := []struct {
+		class string
+		want  []runnerStanding
+	}{
+		{"", []runnerStanding{
+			{1, ana, 2, 2, 10, 10},
+			{2, cid, 2, 1, 18, 0},
+			{2, dan, 2, 0, 9, 9},
+			{4, bob, 1, 0, 10, 0},
+		}},
+		{rankingClassMain, []runnerStanding{
+			{1, cid, 2, 1, 18, 0},
+			{2, ana, 2, 2, 10, 10},
+			{2, bob, 1, 0, 10, 0},
+			{4, dan, 2, 0, 9, 9},
+		}},
+		{rankingClassChallenge, []runnerStanding{
+			{1, ana, 2, 2, 10, 10},
+			{2, dan, 2, 0, 9, 9},
+		}},
+	}
+	for _, test := range tests {
+		standings, err := getRunnerStandings(test.class)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(standings) != len(test.want) {
+			t.Fatalf("class %q: got %d standings, want %d", test.class, len(standings), len(test.want))
+		}
+		for i, want := range test.want {
+			got := standings[i]
+			// Only the fields of runners read for leaderboards are set.
+			if got.Runner.ID != want.Runner.ID {
+				t.Errorf("class %q: standing %d is %s, want %s", test.class, i, got.Runner.Username, want.Runner.Username)
+				continue
+			}
+			got.Runner = want.Runner
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("class %q: got %+v, want %+v", test.class, got, want)
+			}
+		}
+	}
+}
+
+func TestGetRunnerStanding(t *testing.T) {
+	_, _, bob, _, _ := addRankingRuns(t)
+	standing, err := getRunnerStanding(bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if standing.Rank != 4 || standing.TotalPoints() != 10 {
+		t.Errorf("bob is ranked %d with %d points, want 4 with 10", standing.Rank, standing.TotalPoints())
+	}
+	eve := addTestRunner(t, "eve")
+	_, err = getRunnerStanding(eve.ID)
+	if err != errNotRanked {
+		t.Errorf("got %v for a runner without runs, want errNotRanked", err)
+	}
+}
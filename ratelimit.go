@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A rateLimiter allows a limited number of events per key, say an IP address
+// or a username, within a sliding time window. Limits are kept in memory, so
+// they are reset when the server restarts.
+type rateLimiter struct {
+	mutex  sync.Mutex
+	limit  int
+	window time.Duration
+	events map[string][]time.Time
+}
+
+// newRateLimiter returns a rateLimiter allowing `limit` events per key
+// within any period of length `window`.
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, events: make(map[string][]time.Time)}
+}
+
+// allow records an event for a given key and returns true, unless the key
+// has used up its events, in which case nothing is recorded.
+func (l *rateLimiter) allow(key string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	// Forget about keys that have not been seen for a while, so that the
+	// map does not keep growing.
+	if len(l.events) > 1000 {
+		for k := range l.events {
+			l.prune(k, now)
+		}
+	}
+	l.prune(key, now)
+	if len(l.events[key]) >= l.limit {
+		return false
+	}
+	l.events[key] = append(l.events[key], now)
+	return true
+}
+
+// prune removes the events of a key that are outside the window. The mutex
+// must be held.
+func (l *rateLimiter) prune(key string, now time.Time) {
+	events := l.events[key]
+	i := 0
+	for i < len(events) && now.Sub(events[i]) >= l.window {
+		i++
+	}
+	if i == len(events) {
+		delete(l.events, key)
+	} else {
+		l.events[key] = events[i:]
+	}
+}
+
+// clientIP returns the IP address of the client making a request. Behind a
+// reverse proxy, this is the last address in the X-Forwarded-For header, as
+// that is the one added by the proxy.
+func clientIP(r *http.Request) string {
+	if config.BehindProxy {
+		addresses := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		if address := strings.TrimSpace(addresses[len(addresses)-1]); address != "" {
+			return address
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// A backoff keeps track of failures per key, such as failed attempts to log
+// in, and locks a key out for a while once it has failed too often. Each
+// further failure doubles the length of the lockout, up to a maximum. Keys
+// that have not failed for a day are forgotten.
+type backoff struct {
+	mutex        sync.Mutex
+	freeFailures int
+	base         time.Duration
+	max          time.Duration
+	entries      map[string]*backoffEntry
+}
+
+type backoffEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+const backoffMemory = 24 * time.Hour
+
+// newBackoff returns a backoff allowing `freeFailures` failures per key,
+// after which keys are locked out for `base`, then twice that, and so on,
+// but never for longer than `max`.
+func newBackoff(freeFailures int, base, max time.Duration) *backoff {
+	return &backoff{freeFailures: freeFailures, base: base, max: max,
+		entries: make(map[string]*backoffEntry)}
+}
+
+// lockedFor returns for how long a key is still locked out, if at all.
+func (b *backoff) lockedFor(key string) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	entry, ok := b.entries[key]
+	if !ok {
+		return 0
+	}
+	if wait := time.Until(entry.lockedUntil); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// fail records a failure for a key, and returns for how long the key is
+// now locked out, if at all.
+func (b *backoff) fail(key string) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	if len(b.entries) > 1000 {
+		for k, entry := range b.entries {
+			if now.Sub(entry.lastFailure) > backoffMemory && now.After(entry.lockedUntil) {
+				delete(b.entries, k)
+			}
+		}
+	}
+	entry, ok := b.entries[key]
+	if !ok || now.Sub(entry.lastFailure) > backoffMemory {
+		entry = &backoffEntry{}
+		b.entries[key] = entry
+	}
+	entry.failures++
+	entry.lastFailure = now
+	if entry.failures <= b.freeFailures {
+		return 0
+	}
+	lockout := b.max
+	// Beyond a few doublings, we are at the maximum anyway; stopping early
+	// also keeps the shift from overflowing.
+	if doublings := entry.failures - b.freeFailures - 1; doublings < 20 && b.base<<uint(doublings) < b.max {
+		lockout = b.base << uint(doublings)
+	}
+	entry.lockedUntil = now.Add(lockout)
+	return lockout
+}
+
+// reset forgets the failures of a key.
+func (b *backoff) reset(key string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.entries, key)
+}
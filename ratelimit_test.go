@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(2, time.Minute, 5*time.Minute)
+	// The lockout after each failure of a key in a row.
+	tests := []struct {
+		failure int
+		lockout time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 5 * time.Minute},
+		{7, 5 * time.Minute},
+	}
+	for _, test := range tests {
+		lockout := b.fail("ana")
+		if lockout != test.lockout {
+			t.Errorf("failure %d: locked out for %s, want %s", test.failure, lockout, test.lockout)
+		}
+		wait := b.lockedFor("ana")
+		if wait > test.lockout || wait < test.lockout-time.Second {
+			t.Errorf("failure %d: locked for %s, want %s", test.failure, wait, test.lockout)
+		}
+	}
+	if wait := b.lockedFor("bob"); wait != 0 {
+		t.Errorf("a key without failures is locked for %s", wait)
+	}
+
+	// Once a lockout expires, the key may try again, but the next failure
+	// locks it out right away.
+	b.entries["ana"].lockedUntil = time.Now().Add(-time.Second)
+	if wait := b.lockedFor("ana"); wait != 0 {
+		t.Errorf("locked for %s after the lockout expired", wait)
+	}
+	if lockout := b.fail("ana"); lockout != 5*time.Minute {
+		t.Errorf("locked out for %s after the lockout expired, want %s", lockout, 5*time.Minute)
+	}
+
+	// Failures are forgotten after a day.
+	b.entries["ana"].lastFailure = time.Now().Add(-backoffMemory - time.Second)
+	b.entries["ana"].lockedUntil = time.Now().Add(-time.Second)
+	if lockout := b.fail("ana"); lockout != 0 {
+		t.Errorf("locked out for %s after a day without failures", lockout)
+	}
+
+	b.reset("ana")
+	if _, ok := b.entries["ana"]; ok {
+		t.Error("reset kept the failures of a key")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		behindProxy   bool
+		forwardedFor  string
+		remoteAddress string
+		want          string
+	}{
+		{false, "", "192.0.2.1:1234", "192.0.2.1"},
+		{false, "198.51.100.1", "192.0.2.1:1234", "192.0.2.1"},
+		{true, "198.51.100.1", "192.0.2.1:1234", "198.51.100.1"},
+		{true, "203.0.113.1, 198.51.100.1", "192.0.2.1:1234", "198.51.100.1"},
+		{true, "203.0.113.1,198.51.100.1 ", "192.0.2.1:1234", "198.51.100.1"},
+		{true, "", "192.0.2.1:1234", "192.0.2.1"},
+		{true, "203.0.113.1, ", "192.0.2.1:1234", "192.0.2.1"},
+		{false, "", "[2001:db8::1]:1234", "2001:db8::1"},
+		{false, "", "192.0.2.1", "192.0.2.1"},
+	}
+	previous := config.BehindProxy
+	defer func() { config.BehindProxy = previous }()
+	for _, test := range tests {
+		config.BehindProxy = test.behindProxy
+		r := httptest.NewRequest("GET", "/login", nil)
+		r.RemoteAddr = test.remoteAddress
+		if test.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", test.forwardedFor)
+		}
+		if got := clientIP(r); got != test.want {
+			t.Errorf("clientIP(%q from %s, behind proxy: %t) = %s, want %s",
+				test.forwardedFor, test.remoteAddress, test.behindProxy, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+)
+
+// The roles a runner can have. Moderators approve, reject, flag and unflag
+// runs, either in all categories or in those in their ModeratedCategories.
+// Admins moderate all categories, and grant and revoke roles.
+const (
+	roleRunner    = "runner"
+	roleModerator = "moderator"
+	roleAdmin     = "admin"
+)
+
+// roles lists all roles, from the least to the most privileged.
+var roles = []string{roleRunner, roleModerator, roleAdmin}
+
+// IsModerator returns true iff the runner may moderate runs in at least
+// one category.
+func (r *runner) IsModerator() bool {
+	return r.Role == roleModerator || r.Role == roleAdmin
+}
+
+// IsAdmin returns true iff the runner may grant and revoke roles.
+func (r *runner) IsAdmin() bool {
+	return r.Role == roleAdmin
+}
+
+// CanModerate returns true iff the runner may moderate runs in a given
+// category.
+func (r *runner) CanModerate(cat category) bool {
+	switch r.Role {
+	case roleAdmin:
+		return true
+	case roleModerator:
+		if len(r.ModeratedCategories) == 0 {
+			return true
+		}
+		for _, id := range r.ModeratedCategories {
+			if id == cat.ID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FormatRole describes the role of the runner, including the categories
+// they moderate, if limited.
+func (r *runner) FormatRole() string {
+	if r.Role != roleModerator || len(r.ModeratedCategories) == 0 {
+		return r.Role
+	}
+	var names []string
+	for _, id := range r.ModeratedCategories {
+		cat, err := getCategoryByID(id)
+		if err == nil {
+			names = append(names, cat.Name)
+		}
+	}
+	return r.Role + " (" + strings.Join(names, ", ") + ")"
+}
+
+// setRole gives the runner a given role on behalf of a given admin. For
+// moderators, categoryIDs limits the categories they may moderate; it is
+// ignored for other roles.
+func (r *runner) setRole(admin runner, role string, categoryIDs []int) error {
+	if !admin.IsAdmin() {
+		return errors.New("Only admins can grant and revoke roles.")
+	}
+	// This keeps the site from ending up without admins by accident.
+	if admin.ID == r.ID && role != roleAdmin {
+		return errors.New("Admins can not revoke their own role.")
+	}
+	legitRole := false
+	for _, legit := range roles {
+		if legit == role {
+			legitRole = true
+		}
+	}
+	if !legitRole {
+		return errors.New("Unknown role.")
+	}
+	if role != roleModerator {
+		categoryIDs = nil
+	}
+	for _, id := range categoryIDs {
+		if _, err := getCategoryByID(id); err != nil {
+			return errors.New("Unknown category.")
+		}
+	}
+	err := db.setRole(r.ID, role, categoryIDs)
+	if err != nil {
+		return errors.New("Could not perform database query: " + err.Error())
+	}
+	r.Role = role
+	r.ModeratedCategories = categoryIDs
+	logRunnerAction(admin, auditSetRole, *r, r.FormatRole())
+	return nil
+}
+
+// getStaff returns all moderators and admins.
+func getStaff() ([]runner, error) {
+	return db.getStaff()
+}
+
+// getModeratorEmails returns the email addresses of all moderators who
+// may moderate a given category.
+func getModeratorEmails(cat category) []string {
+	moderatorEmails := []string{}
+	staff, err := getStaff()
+	if err != nil {
+		log.Println("Could not get moderators: ", err)
+		return moderatorEmails
+	}
+	for _, moderator := range staff {
+		if moderator.CanModerate(cat) && moderator.Email != "" && moderator.EmailVerified {
+			moderatorEmails = append(moderatorEmails, moderator.Email)
+		}
+	}
+	return moderatorEmails
+}
+
+// makeAdmin makes the runner with a given username an admin. This is how
+// the first admin of a site is created; see the -make-admin flag.
+func makeAdmin(username string) error {
+	r, err := getRunnerByUsername(username)
+	if err != nil {
+		return errors.New("No runner with the given username.")
+	}
+	return db.setRole(r.ID, roleAdmin, nil)
+}
+
+// importLegacyModerators makes the runners listed in the legacy
+// moderatorIDs setting moderators of all categories, unless they already
+// have a role. Roles used to be given by that setting alone, so this keeps
+// moderators from losing their role on upgrades. The import happens once;
+// afterwards the setting is ignored, so admins can demote these moderators.
+func importLegacyModerators() error {
+	imported, err := db.legacyImported("moderatorIDs")
+	if err != nil {
+		return err
+	}
+	if imported {
+		if len(config.LegacyModerators) > 0 {
+			log.Println("Ignoring moderatorIDs, which has already been imported; remove it from the configuration.")
+		}
+		return nil
+	}
+	for _, id := range config.LegacyModerators {
+		r, err := getRunnerByID(id)
+		if err != nil {
+			log.Printf("Skipping runner %d in moderatorIDs: %s", id, err)
+			continue
+		}
+		if r.Role != roleRunner {
+			continue
+		}
+		err = db.setRole(r.ID, roleModerator, nil)
+		if err != nil {
+			return err
+		}
+		log.Printf("Made %s a moderator as listed in moderatorIDs.", r.Username)
+	}
+	if len(config.LegacyModerators) > 0 {
+		log.Println("The moderators in moderatorIDs are now stored in the database; remove moderatorIDs from the configuration.")
+	}
+	return db.markLegacyImported("moderatorIDs")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestImportLegacyModerators(t *testing.T) {
+	useTestStore(t)
+	ana := addTestRunner(t, "ana")
+	bob := addTestRunner(t, "bob")
+	cid := addTestRunner(t, "cid")
+	err := db.setRole(bob.ID, roleAdmin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := config.LegacyModerators
+	config.LegacyModerators = []int{ana.ID, bob.ID, 404}
+	defer func() { config.LegacyModerators = previous }()
+
+	err = importLegacyModerators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []struct {
+		runner runner
+		role   string
+	}{{ana, roleModerator}, {bob, roleAdmin}, {cid, roleRunner}} {
+		got, err := getRunnerByID(want.runner.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Role != want.role || len(got.ModeratedCategories) != 0 {
+			t.Errorf("%s has role %s in %v, want %s in all categories",
+				got.Username, got.Role, got.ModeratedCategories, want.role)
+		}
+	}
+}
+
+func TestImportLegacyModeratorsOnce(t *testing.T) {
+	useTestStore(t)
+	ana := addTestRunner(t, "ana")
+	previous := config.LegacyModerators
+	config.LegacyModerators = []int{ana.ID}
+	defer func() { config.LegacyModerators = previous }()
+
+	err := importLegacyModerators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An admin demotes ana, and the site is restarted with moderatorIDs
+	// still in place.
+	err = db.setRole(ana.ID, roleRunner, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = importLegacyModerators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := getRunnerByID(ana.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Role != roleRunner {
+		t.Errorf("ana has role %s after a second import, want %s", got.Role, roleRunner)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A runFilter limits a leaderboard to the runs matching all of its fields,
+// as in "best Van Helsing Hell run" or "best Danish Any%". The runs left are
+// ranked among themselves. Zero fields do not filter.
+type runFilter struct {
+	Platform platform
+	// Spelunker is nil unless the filter is limited to a single spelunker;
+	// its ID can not be used for that, as Spelunky Guy has ID 0.
+	Spelunker *spelunker
+	Country   string
+	// From and To are the first and last days on which the runs were
+	// submitted, in UTC.
+	From time.Time
+	To   time.Time
+}
+
+// runFilterDateFormat is the format of the dates in filters.
+const runFilterDateFormat = "2006-01-02"
+
+// parseRunFilter reads a filter from the query string of a request, such as
+// "platform=psn&spelunker=9&country=DK&from=2016-01-01&to=2016-12-31".
+func parseRunFilter(query url.Values) (filter runFilter, err error) {
+	if abbr := query.Get("platform"); abbr != "" {
+		filter.Platform, err = getPlatformByAbbr(abbr)
+		if err != nil {
+			return runFilter{}, errors.New("Unknown platform.")
+		}
+	}
+	if value := query.Get("spelunker"); value != "" {
+		spelunkerID, err := strconv.Atoi(value)
+		if err != nil {
+			return runFilter{}, errors.New("Unknown spelunker.")
+		}
+		s, err := getSpelunkerByID(spelunkerID)
+		if err != nil {
+			return runFilter{}, errors.New("Unknown spelunker.")
+		}
+		filter.Spelunker = &s
+	}
+	if country := strings.ToUpper(query.Get("country")); country != "" {
+		if countries[country] == "" {
+			return runFilter{}, errors.New("Unknown country.")
+		}
+		filter.Country = country
+	}
+	if from := query.Get("from"); from != "" {
+		filter.From, err = time.Parse(runFilterDateFormat, from)
+		if err != nil {
+			return runFilter{}, errors.New("Dates must be given as YYYY-MM-DD.")
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		filter.To, err = time.Parse(runFilterDateFormat, to)
+		if err != nil {
+			return runFilter{}, errors.New("Dates must be given as YYYY-MM-DD.")
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return runFilter{}, errors.New("The first day can not be after the last day.")
+	}
+	return filter, nil
+}
+
+// IsEmpty returns true iff the filter lets all runs through.
+func (f *runFilter) IsEmpty() bool {
+	return f.Platform.ID == 0 && f.Spelunker == nil && f.Country == "" &&
+		f.From.IsZero() && f.To.IsZero()
+}
+
+// HasSpelunker returns true iff the filter is limited to the spelunker with a
+// given ID.
+func (f *runFilter) HasSpelunker(id int) bool {
+	return f.Spelunker != nil && f.Spelunker.ID == id
+}
+
+// FormatFrom formats the first day of the filter, if any.
+func (f *runFilter) FormatFrom() string {
+	if f.From.IsZero() {
+		return ""
+	}
+	return f.From.Format(runFilterDateFormat)
+}
+
+// FormatTo formats the last day of the filter, if any.
+func (f *runFilter) FormatTo() string {
+	if f.To.IsZero() {
+		return ""
+	}
+	return f.To.Format(runFilterDateFormat)
+}
+
+// Query returns the query string read by parseRunFilter, including the
+// leading "?", or the empty string for empty filters. It is appended to
+// addresses of leaderboards and exports, so that they show the same runs.
+func (f *runFilter) Query() string {
+	values := url.Values{}
+	if f.Platform.ID != 0 {
+		values.Set("platform", f.Platform.Abbr)
+	}
+	if f.Spelunker != nil {
+		values.Set("spelunker", strconv.Itoa(f.Spelunker.ID))
+	}
+	if f.Country != "" {
+		values.Set("country", f.Country)
+	}
+	if !f.From.IsZero() {
+		values.Set("from", f.FormatFrom())
+	}
+	if !f.To.IsZero() {
+		values.Set("to", f.FormatTo())
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
@@ -14,51 +14,78 @@ type runner struct {
 	// Password is a bcrypted hash of the runner's password
 	Password string
 	Email    string
-	Country  string
+	// EmailVerified is true once the runner has confirmed that Email is
+	// theirs; see emailverification.go.
+	EmailVerified bool
+	Country       string
 	// Spelunker is the runner's default spelunker
 	Spelunker spelunker
-	// Steam is the runner's Steam64 ID
-	Steam    int
-	Psn      string
-	Xbla     string
-	Twitch   string
-	YouTube  string
-	FreeText string
+	// Steam is the runner's Steam64 ID, and SteamVerified is true iff the
+	// runner has linked it by signing in through Steam; see steamopenid.go.
+	Steam         int
+	SteamVerified bool
+	Psn           string
+	Xbla          string
+	Twitch        string
+	YouTube       string
+	FreeText      string
 	// EmailFlag is true iff the runner gets emails on flagged runs
 	EmailFlag bool
 	// EmailWr is true iff the runner gets emails on new WRs
 	EmailWr bool
 	// EmailChallenge is true iff the runner gets emails on new WRs in challenge categories
 	EmailChallenge bool
-}
-
-// searchRunner returns a user on the site, found by applying a given filter
-func searchRunner(constraints string, values ...interface{}) (r runner, err error) {
-	query := "SELECT id, username, pass, email, country, spelunker, steam, psn, xbla, twitch, youtube, freetext, emailflag, emailwr, emailChallenge FROM users " + constraints
-	statement, err := db.Prepare(query)
-	if err != nil {
-		return
-	}
-	defer statement.Close()
-	var spelunkerID int
-	err = statement.QueryRow(values...).Scan(&r.ID, &r.Username, &r.Password, &r.Email, &r.Country, &spelunkerID, &r.Steam, &r.Psn, &r.Xbla, &r.Twitch, &r.YouTube, &r.FreeText, &r.EmailFlag, &r.EmailWr, &r.EmailChallenge)
-	r.Spelunker, _ = getSpelunkerByID(spelunkerID)
-	return
+	// Role is one of roleRunner, roleModerator and roleAdmin; see roles.go.
+	Role string
+	// ModeratedCategories are the IDs of the categories a moderator may
+	// moderate. Moderators without any may moderate all categories.
+	ModeratedCategories []int
 }
 
 // getRunnerById returns the user with the specific numerical id
 func getRunnerByID(id int) (runner, error) {
-	return searchRunner("WHERE id = ?", id)
+	return db.getRunnerByID(id)
 }
 
 // getRunnerByUsername returns the user with a given username
 func getRunnerByUsername(username string) (runner, error) {
-	return searchRunner("WHERE username = ?", username)
+	return db.getRunnerByUsername(username)
+}
+
+// getRunnerBySteam returns the user who has linked a given Steam account
+func getRunnerBySteam(steamID int) (runner, error) {
+	return db.getRunnerBySteam(steamID)
 }
 
 // getRunnerByUsernameAndEmail returns the user with a given username and email
 func getRunnerByUsernameAndEmail(username, email string) (runner, error) {
-	return searchRunner("WHERE username = ? AND email = ?", username, email)
+	return db.getRunnerByUsernameAndEmail(username, email)
+}
+
+// getWorldRecordSubscribers returns the users who want to be notified
+// by mail about new world records in a given category.
+func getWorldRecordSubscribers(cat category) ([]runner, error) {
+	return db.getWorldRecordSubscribers(cat.isMain())
+}
+
+var errSteamAlreadyLinked = errors.New("This Steam account is already linked to another runner.")
+
+// linkSteam links the runner to a Steam account whose ownership has been
+// verified, or unlinks their Steam account if steamID is 0.
+func (r *runner) linkSteam(steamID int) error {
+	if steamID != 0 {
+		other, err := getRunnerBySteam(steamID)
+		if err == nil && other.ID != r.ID {
+			return errSteamAlreadyLinked
+		}
+	}
+	err := db.setSteam(r.ID, steamID)
+	if err != nil {
+		return err
+	}
+	r.Steam = steamID
+	r.SteamVerified = steamID != 0
+	return nil
 }
 
 // makeUser creates a new user with a given username, email, and password
@@ -67,26 +94,79 @@ func makeUser(username, email, password string) (err error) {
 	if err != nil {
 		return
 	}
-	query, err := db.Prepare("INSERT INTO users SET username = ?, email = ?, pass = ?")
-	if err != nil {
-		return
+	return db.makeUser(username, email, string(hashedPassword))
+}
+
+// obsoleteRunsByCategory marks all current runs the user has in a
+// given category as superseded, removing them from the leaderboards.
+func (r *runner) obsoleteRunsByCategory(cat category) error {
+	return db.obsoleteRunsByCategory(r.ID, cat)
+}
+
+// The range of Steam64 IDs of individual Steam accounts.
+const minSteam64 = 76561197960265728
+const maxSteam64 = 76561202255233023
+
+// validate returns an error describing the first field of the runner
+// that can not be stored in the database.
+func (r *runner) validate() error {
+	// The lengths are bounded by the sizes of the database columns.
+	if !isLegitUsername(r.Username) {
+		return errors.New("Username contains unallowed characters.")
 	}
-	_, err = query.Exec(username, email, string(hashedPassword))
-	return
+	if len(r.Username) > 25 {
+		return errors.New("Username can be at most 25 characters long.")
+	}
+	if otherRunner, err := getRunnerByUsername(r.Username); err == nil && otherRunner.ID != r.ID {
+		return errors.New("A user with that username already exists.")
+	}
+	if r.Email != "" && !isLegitEmailAddress(r.Email) {
+		return errors.New("Email address looks illegit.")
+	}
+	if len(r.Email) > 40 {
+		return errors.New("Email address can be at most 40 characters long.")
+	}
+	if _, ok := countries[r.Country]; !ok {
+		return errors.New("Unknown country.")
+	}
+	if _, err := getSpelunkerByID(r.Spelunker.ID); err != nil {
+		return errors.New("Unknown spelunker.")
+	}
+	if r.Steam != 0 && (r.Steam < minSteam64 || r.Steam > maxSteam64) {
+		return errors.New("Steam64 ID is not a valid ID; it should look like 765611...")
+	}
+	if len(r.Psn) > 25 || len(r.Xbla) > 25 || len(r.Twitch) > 25 || len(r.YouTube) > 25 {
+		return errors.New("Community profile names can be at most 25 characters long.")
+	}
+	if len(r.FreeText) > 1000 {
+		return errors.New("Profile text can be at most 1000 characters long.")
+	}
+	return nil
 }
 
-// removeRunsByCategory removes from the database all runs the
-// user has in a given category.
-func (r *runner) removeRunsByCategory(cat category) (err error) {
-	// It would arguably follow the logic of the app a bit closer
-	// to find the runs in question and invoke deleteFromDatabase on
-	// them, but let's just do it the straightforward way.
-	query, err := db.Prepare("DELETE FROM runs WHERE runner = ? AND cat = ?")
+// update validates the runner and stores it in the database. If the given
+// password is non-empty, the password of the runner is changed as well.
+func (r *runner) update(password string) error {
+	err := r.validate()
 	if err != nil {
-		return
+		return err
 	}
-	_, err = query.Exec(r.ID, cat.ID)
-	return
+	var hashedPassword []byte
+	if password != "" {
+		hashedPassword, err = bcrypt.GenerateFromPassword([]byte(password), 12)
+		if err != nil {
+			return err
+		}
+	}
+	err = db.updateRunner(r, string(hashedPassword))
+	if err != nil {
+		return err
+	}
+	if password != "" {
+		r.Password = string(hashedPassword)
+	}
+	r.Spelunker, _ = getSpelunkerByID(r.Spelunker.ID)
+	return nil
 }
 
 // updatePassword sets a new password for the runner.
@@ -98,12 +178,7 @@ func (r *runner) updatePassword(password string) error {
 	if err != nil {
 		return err
 	}
-	query, err := db.Prepare("UPDATE users SET pass = ? WHERE username = ?")
-	if err != nil {
-		return err
-	}
-	_, err = query.Exec(string(hashedPassword), r.Username)
-	return err
+	return db.updatePassword(r.Username, string(hashedPassword))
 }
 
 // testLogin tries to log in a user with a given password
@@ -123,25 +198,19 @@ func (r *runner) testLogin(password string) (err error) {
 	return
 }
 
-// sendMail sends an email to the runner with a given subject and message body
+// sendMail sends an email to the runner with a given subject and message body,
+// provided that their address is verified.
 func (r *runner) sendMail(subject, body string) error {
 	if r.Email == "" {
 		return errors.New("user has no associated email address")
 	}
+	if !r.EmailVerified {
+		return errors.New("user has not verified their email address")
+	}
 	err := sendMail(r.Email, subject, body)
 	return err
 }
 
-// isModerator returns true iff the user is a site moderator
-func (r *runner) IsModerator() bool {
-	for _, moderatorID := range config.Moderators {
-		if moderatorID == r.ID {
-			return true
-		}
-	}
-	return false
-}
-
 // formatCountry produces the full name of the runner's chosen country
 func (r *runner) FormatCountry() string {
 	return countries[r.Country]
@@ -3,16 +3,23 @@ package main
 import (
 	"errors"
 	"fmt"
+	"log"
+	"math"
+	"sort"
 	"time"
 )
 
 type run struct {
 	// ID is the ID representing the run in the database.
 	ID int
-	// RankInCategory describes the rank of the run if it is in the database.
+	// RankInCategory describes the rank of the run if it is on the
+	// leaderboards. Runs with equal results share a rank; see rankRuns.
 	RankInCategory int
-	Runner         runner
-	Category       category
+	// TieBreak is the position of the run among the runs sharing its rank,
+	// by time of submission, starting at 1. It is 0 for runs without ties.
+	TieBreak int
+	Runner   runner
+	Category category
 	// Score is the score of the run. For score runs it is the actual score, and
 	// for speed runs, it is the completion time in milliseconds.
 	Score int
@@ -20,13 +27,29 @@ type run struct {
 	// 1-1 is represented by 1, 1-4 by 4, and 2-1 by 5.
 	Level     int
 	Link      string
-	Platform  int
+	Platform  platform
 	Spelunker spelunker
 	// Time is the Unix time of submission of the run.
 	Time    time.Time
 	Comment string
 	// Flag is a string describing the reason for removal for removed runs.
 	Flag string
+	// Pending is true iff the run is waiting to be approved by a moderator.
+	Pending bool
+	// Obsoleted is the time at which the run was superseded by another run
+	// by the same runner in the same category. For current runs, it is the
+	// zero time.
+	Obsoleted time.Time
+	// Approved is the time at which the run appeared on the leaderboards,
+	// which is its time of submission unless it had to be reviewed. For
+	// pending runs, it is the zero time.
+	Approved time.Time
+	// Appeal is the runner's explanation of why a flagged run should be
+	// unflagged, and Appealed is the time it was given. If a moderator
+	// has looked at the appeal and kept the flag, AppealDismissed is true.
+	Appeal          string
+	Appealed        time.Time
+	AppealDismissed bool
 }
 
 // getAllWorldRecords returns a slice of all current world records
@@ -40,175 +63,415 @@ func getAllWorldRecords() ([]run, error) {
 		if err != nil {
 			return nil, err
 		}
-		records = append(records, runsInCategory[0])
+		// Categories may be empty, for instance on new installations.
+		if len(runsInCategory) > 0 {
+			records = append(records, runsInCategory[0])
+		}
 	}
 	return records, nil
 }
 
-// getRunsByCategory returns the top `limit` runs in a given category. If `limit` is 0, returns all runs.
-func getRunsByCategory(category category, limit int64) (runs []run, err error) {
-	query := "SELECT runs.id, runs.score, runs.level, runs.link, runs.spelunker, runs.date, runs.comment, users.id, users.username, users.country FROM runs INNER JOIN users ON runs.runner = users.id WHERE runs.cat = ? AND runs.flag = '' ORDER BY runs.score"
-	if category.Goal == "Score" {
-		query += " DESC"
+// getWorldRecordsByPlatform returns the current world record on a given
+// platform in each category, in the order of getAllCategories. The record
+// is nil for categories without runs on the platform.
+func getWorldRecordsByPlatform(p platform) ([]*run, error) {
+	var records []*run
+	for _, cat := range getAllCategories() {
+		runsInCategory, err := getFilteredRuns(cat, runFilter{Platform: p}, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(runsInCategory) > 0 {
+			records = append(records, &runsInCategory[0])
+		} else {
+			records = append(records, nil)
+		}
+	}
+	return records, nil
+}
+
+// getCurrentRunsByCategory returns the current runs in all categories, in the
+// order of getAllCategories.
+func getCurrentRunsByCategory() ([][]run, error) {
+	var allRuns [][]run
+	for _, cat := range getAllCategories() {
+		runs, err := getRunsByCategory(cat, 0)
+		if err != nil {
+			return nil, err
+		}
+		allRuns = append(allRuns, runs)
 	}
+	return allRuns, nil
+}
+
+// getRunsByCategory returns the top `limit` runs in a given category. If `limit` is 0, returns all runs.
+func getRunsByCategory(category category, limit int64) ([]run, error) {
+	return getFilteredRuns(category, runFilter{}, limit)
+}
+
+// getFilteredRuns returns the top `limit` runs in a given category matching a
+// given filter, ranked among themselves. If `limit` is 0, returns all runs.
+func getFilteredRuns(category category, filter runFilter, limit int64) ([]run, error) {
+	// With a limit, we need one more run to tell if the last run is tied.
+	fetchLimit := limit
 	if limit != 0 {
-		query += fmt.Sprintf(" LIMIT %d", limit)
+		fetchLimit++
 	}
-	statement, err := db.Prepare(query)
+	runs, err := db.getRunsByCategory(category, filter, fetchLimit)
 	if err != nil {
-		return
+		return nil, err
 	}
-	defer statement.Close()
-	rows, err := statement.Query(category.ID)
-	if err != nil {
-		return
+	rankRuns(runs, category)
+	if limit != 0 && int64(len(runs)) > limit {
+		runs = runs[:limit]
 	}
-	i := 1
-	for rows.Next() {
-		var r run
-		var p runner
-		var spelunkerID int
-		var unixTime int64
-		err = rows.Scan(&r.ID, &r.Score, &r.Level, &r.Link, &spelunkerID, &unixTime, &r.Comment, &p.ID, &p.Username, &p.Country)
-		if err != nil {
-			return
+	return runs, nil
+}
+
+// sharedRanks returns the ranks of `n` entries in order, best first, where
+// equal(i, j) tells if entries i and j are tied. Tied entries share a rank,
+// and the ranks taken up by ties are skipped, as in "1, 1, 3".
+func sharedRanks(n int, equal func(i, j int) bool) []int {
+	ranks := make([]int, n)
+	for i := range ranks {
+		if i > 0 && equal(i-1, i) {
+			ranks[i] = ranks[i-1]
+		} else {
+			ranks[i] = i + 1
+		}
+	}
+	return ranks
+}
+
+// rankRuns orders runs in a given category, best first, and sets their
+// ranks. Runs with equal results share a rank; among them, the earliest
+// submission comes first, and TieBreak gives their order. This is the
+// only place where runs are ranked, so that all leaderboards agree.
+func rankRuns(runs []run, cat category) {
+	sort.SliceStable(runs, func(i, j int) bool {
+		if runs[i].Score != runs[j].Score {
+			return cat.beats(runs[i].Score, runs[j].Score)
+		}
+		if !runs[i].Time.Equal(runs[j].Time) {
+			return runs[i].Time.Before(runs[j].Time)
+		}
+		return runs[i].ID < runs[j].ID
+	})
+	ranks := sharedRanks(len(runs), func(i, j int) bool {
+		return runs[i].Score == runs[j].Score
+	})
+	for i := range runs {
+		runs[i].RankInCategory = ranks[i]
+		runs[i].TieBreak = 0
+		tied := (i > 0 && ranks[i-1] == ranks[i]) || (i+1 < len(runs) && ranks[i+1] == ranks[i])
+		if tied {
+			runs[i].TieBreak = i + 2 - ranks[i]
 		}
-		r.Runner = p
-		r.Category = category
-		r.Spelunker, _ = getSpelunkerByID(spelunkerID)
-		r.Time = time.Unix(unixTime, 0)
-		r.RankInCategory = i
-		runs = append(runs, r)
-		i++
 	}
-	return
 }
 
 // getRunsByRunnerID produces a slice of all runs registered for a given runner,
-func getRunsByRunnerID(runnerID int) (runs []run, err error) {
-	runner, err := getRunnerByID(runnerID)
+func getRunsByRunnerID(runnerID int) ([]run, error) {
+	return db.getRunsByRunnerID(runnerID)
+}
+
+// getRunHistoryByCategory returns all approved, unflagged runs in a given
+// category, including superseded ones, in the order they were approved.
+func getRunHistoryByCategory(category category) ([]run, error) {
+	return db.getRunHistoryByCategory(category)
+}
+
+// getRunByID returns the run with a given integral ID.
+func getRunByID(runID int) (run, error) {
+	return db.getRunByID(runID)
+}
+
+// getPendingRuns returns all runs waiting to be approved by a moderator.
+func getPendingRuns() ([]run, error) {
+	return db.getPendingRuns()
+}
+
+// getAppealedRuns returns all flagged runs whose runners have appealed the
+// flag, and whose appeals are waiting for a moderator.
+func getAppealedRuns() ([]run, error) {
+	return db.getAppealedRuns()
+}
+
+// hypotheticalRank calculates the rank that a given result by the runner
+// with a given ID would achieve on the leaderboards of a given category,
+// ranked as by rankRuns. The runner's current run is left out, as the new
+// run replaces it. As a new run is submitted after all runs on the
+// leaderboards, it loses all ties, which is returned in `tied`; for example,
+// the result is a new WR only if the rank is 1 and it is not tied. For a
+// score run, the given result is the score, and for a speed run, it is the
+// time in milliseconds.
+func hypotheticalRank(result int, runnerID int, cat category) (rank int, tied bool, err error) {
+	runs, err := getRunsByCategory(cat, 0)
 	if err != nil {
 		return
 	}
-	query := "SELECT id, cat, score, level, link, spelunker, date, comment, flag FROM runs WHERE runner = ? ORDER BY cat"
-	statement, err := db.Prepare(query)
-	if err != nil {
-		return
+	// The new run is ranked along with the others by rankRuns, as the
+	// newest run, and with an ID no stored run has.
+	leaderboard := []run{{ID: math.MaxInt32, Score: result, Time: time.Now()}}
+	for _, r := range runs {
+		if r.Runner.ID != runnerID {
+			leaderboard = append(leaderboard, r)
+		}
+	}
+	rankRuns(leaderboard, cat)
+	for _, r := range leaderboard {
+		if r.ID == math.MaxInt32 {
+			return r.RankInCategory, r.TieBreak > 0, nil
+		}
 	}
-	defer statement.Close()
-	rows, err := statement.Query(runnerID)
+	return
+}
+
+// flag flags the run on behalf of a given moderator, removing it from the
+// leaderboards, and informing the runner the reason why. Flagging a run that
+// is waiting for approval rejects it.
+func (r *run) flag(moderator runner, reason string) error {
+	err := db.flag(r.ID, reason)
 	if err != nil {
-		return
+		return errors.New("Could not perform database query: " + err.Error())
+	}
+	if r.Pending {
+		logRunAction(moderator, auditReject, *r, reason)
+	} else {
+		logRunAction(moderator, auditFlag, *r, reason)
 	}
-	for rows.Next() {
-		var r run
-		var spelunkerID int
-		var categoryID int
-		var unixTime int64
-		err = rows.Scan(&r.ID, &categoryID, &r.Score, &r.Level, &r.Link, &spelunkerID, &unixTime, &r.Comment, &r.Flag)
+	// Now inform the user if they have asked to be informed
+	if r.Runner.EmailFlag {
+		mailBody := "Hi %s.\n\nThis is to inform you that your Moss Tier run " +
+			"in the category %s has been flagged as violating the rules by one " +
+			"of the moderators. The reason they gave was the following:\n\n%s"
+		err = r.Runner.sendMail("Moss Tier run flagged",
+			fmt.Sprintf(mailBody, r.Runner.Username, r.Category.Name, reason))
 		if err != nil {
-			return
+			return errors.New("Flagged run but could not inform user: " + err.Error())
 		}
-		r.Runner = runner
-		r.Category, _ = getCategoryByID(categoryID)
-		r.Spelunker, _ = getSpelunkerByID(spelunkerID)
-		r.Time = time.Unix(unixTime, 0)
-		runs = append(runs, r)
 	}
-	return
+	return nil
 }
 
-// getRunByID returns the run with a given integral ID.
-func getRunByID(runID int) (r run, err error) {
-	stmt, err := db.Prepare("SELECT runs.score, runs.cat, runs.level, runs.link, runs.spelunker, runs.comment, users.username FROM runs INNER JOIN users ON runs.runner = users.id WHERE runs.id = ?")
+// submit adds the run to the database, replacing any runs the runner
+// already has in the same category. Both happen in a single transaction,
+// so the leaderboards never show the runner with zero or two runs. If the
+// run is a new world record, it is recorded as such, and subscribers are
+// notified in the background. In categories needing review, the run is
+// left pending, and all of this happens once it is approved.
+func (r *run) submit() (err error) {
+	// All fields but ID, RankInCategory, TieBreak, Link, Time and Flag are
+	// mandatory.
+	// Note that the spelunker with ID 0 is Spelunky Guy, so we can not
+	// check for that.
+	if r.Runner.ID == 0 || r.Category.ID == 0 || r.Score == 0 || r.Level == 0 ||
+		r.Platform.ID == 0 || r.Comment == "" {
+		return errors.New("Could not add to database: Missing mandatory field.")
+	}
+	r.Pending = r.Category.needsReview()
+	if r.Pending {
+		return db.replaceRun(r, false)
+	}
+	rank, tied, err := hypotheticalRank(r.Score, r.Runner.ID, r.Category)
 	if err != nil {
 		return
 	}
-	defer stmt.Close()
-	var categoryID int
-	var spelunkerID int
-	err = stmt.QueryRow(runID).Scan(&r.Score, &categoryID, &r.Level, &r.Link, &spelunkerID, &r.Comment, &r.Runner.Username)
-	r.Runner, _ = getRunnerByUsername(r.Runner.Username)
-	r.ID = runID
-	r.Category, _ = getCategoryByID(categoryID)
-	r.Spelunker, _ = getSpelunkerByID(spelunkerID)
+	isWorldRecord := rank == 1 && !tied
+	err = db.replaceRun(r, isWorldRecord)
+	if err != nil {
+		return
+	}
+	if isWorldRecord {
+		r.notifyWorldRecord()
+	}
 	return
 }
 
-// hypotheticalRank calculates the rank that a given result would achieve
-// on the leaderboards of a given category. For example, if the result would
-// be a new WR, the rank returned is 1. For a score run, the given result is
-// the score, and for a speed run, it is the time in milliseconds.
-func hypotheticalRank(result int, cat category) (rank int, err error) {
-	// We use the category goal to define whether or not we are interested
-	// in scores below or above the given one.
-	var inequality string
-	if cat.Goal == "Score" {
-		inequality = ">="
-	} else if cat.Goal == "Time" {
-		inequality = "<="
-	} else {
-		err = errors.New("Unknown category goal. Expected \"Score\" or \"Time\". Got " + cat.Goal)
+// approve puts a pending run on the leaderboards on behalf of a given
+// moderator, replacing the runner's previous run in the category, and
+// handles new world records as submit does.
+func (r *run) approve(moderator runner) (err error) {
+	if !r.Pending {
+		return errors.New("Run is not waiting for approval.")
+	}
+	rank, tied, err := hypotheticalRank(r.Score, r.Runner.ID, r.Category)
+	if err != nil {
 		return
 	}
-	query, err := db.Prepare("SELECT COUNT(*) FROM runs WHERE cat = ? AND score " + inequality + " ?")
+	isWorldRecord := rank == 1 && !tied
+	err = db.approveRun(r, isWorldRecord)
 	if err != nil {
 		return
 	}
-	err = query.QueryRow(cat.ID, result).Scan(&rank)
-	rank++
+	logRunAction(moderator, auditApprove, *r, "")
+	if isWorldRecord {
+		r.notifyWorldRecord()
+	}
 	return
 }
 
-// flag flags the run, removing it from the leaderboards, and
-// informing the runner the reason why.
-func (r *run) flag(reason string) error {
-	query, err := db.Prepare("UPDATE runs SET flag = ? WHERE id = ?")
-	if err != nil {
-		return errors.New("Could not prepare database: " + err.Error())
+// unflag clears the flag of the run on behalf of a given moderator, making
+// it appear on the leaderboards again, and informs the runner. Runs that were
+// flagged while waiting for approval are approved.
+func (r *run) unflag(moderator runner) error {
+	if r.Flag == "" {
+		return errors.New("Run is not flagged.")
 	}
-	_, err = query.Exec(reason, r.ID)
+	err := db.unflag(r.ID)
 	if err != nil {
 		return errors.New("Could not perform database query: " + err.Error())
 	}
-	// Now inform the user if they have asked to be informed
-	if r.Runner.EmailFlag {
-		mailBody := "Hi %s.\n\nThis is to inform you that your Moss Tier run " +
-			"in the category %s has been flagged as violating the rules by one " +
-			"of the moderators. The reason they gave was the following:\n\n%s"
-		err = r.Runner.sendMail("Moss Tier run flagged",
-			fmt.Sprintf(mailBody, r.Runner.Username, r.Category.Name, reason))
+	logRunAction(moderator, auditUnflag, *r, r.Appeal)
+	r.Flag = ""
+	onLeaderboards := true
+	if r.Pending {
+		err = r.approve(moderator)
 		if err != nil {
-			return errors.New("Flagged run but could not inform user: " + err.Error())
+			return errors.New("Unflagged run but could not approve it: " + err.Error())
+		}
+	} else {
+		onLeaderboards, err = r.reinstate()
+		if err != nil {
+			return errors.New("Unflagged run but could not put it back on the leaderboards: " + err.Error())
+		}
+	}
+	// Runners who appealed asked to hear about the outcome.
+	if r.Runner.EmailFlag || r.Appeal != "" {
+		mailBody := "Hi %s.\n\nThis is to inform you that the flag on your Moss " +
+			"Tier run in the category %s has been removed by one of the moderators"
+		if onLeaderboards {
+			mailBody += ", and that the run is back on the leaderboards."
+		} else {
+			mailBody += ". As your current run in the category is at least as " +
+				"good, the run stays in your run history rather than on the leaderboards."
+		}
+		err = r.Runner.sendMail("Moss Tier run unflagged",
+			fmt.Sprintf(mailBody, r.Runner.Username, r.Category.Name))
+		if err != nil {
+			return errors.New("Unflagged run but could not inform user: " + err.Error())
 		}
 	}
 	return nil
 }
 
-// addToDatabase adds the run to the database, remo
-func (r *run) addToDatabase() (err error) {
-	// All fields but ID, RankInCategory, Time and Flag are mandatory
-	if r.Runner.ID == 0 || r.Category.ID == 0 || r.Score == 0 || r.Level == 0 ||
-		r.Platform == 0 || r.Spelunker.ID == 0 || r.Comment == "" {
-		return errors.New("Could not add to database: Missing mandatory field.")
+// reinstate puts an approved, unflagged run back on the leaderboards, and
+// handles new world records as submit does. Runs superseded while they were
+// flagged only come back if they beat the current run by the runner in the
+// category; reinstate returns whether the run is on the leaderboards.
+func (r *run) reinstate() (bool, error) {
+	if r.IsObsolete() {
+		runs, err := getRunsByRunnerID(r.Runner.ID)
+		if err != nil {
+			return false, err
+		}
+		for _, other := range runs {
+			if other.ID != r.ID && other.Category.ID == r.Category.ID && !other.IsObsolete() &&
+				!other.Pending && other.Flag == "" && !r.Category.beats(r.Score, other.Score) {
+				return false, nil
+			}
+		}
 	}
-	currentTime := time.Now().Unix()
-	query, err := db.Prepare("INSERT INTO runs SET runner = ?, cat = ?, score = ?, level = ?, link = ?, platform = ?, spelunker = ?, time = ?, comment = ?")
+	rank, tied, err := hypotheticalRank(r.Score, r.Runner.ID, r.Category)
 	if err != nil {
-		return
+		return false, err
 	}
-	_, err = query.Exec(r.Runner.ID, r.Category.ID, r.Score, r.Level, r.Link, r.Platform, r.Spelunker.ID, currentTime, r.Comment)
-	return
+	isWorldRecord := rank == 1 && !tied
+	err = db.reinstateRun(r, isWorldRecord)
+	if err != nil {
+		return false, err
+	}
+	if isWorldRecord {
+		r.notifyWorldRecord()
+	}
+	return true, nil
 }
 
-// deleteFromDatabase removes the run from the database.
-func (r *run) deleteFromDatabase() (err error) {
-	query, err := db.Prepare("DELETE FROM runs WHERE id = ?")
+// appeal asks the moderators to reconsider the flag on the run, giving
+// a given explanation.
+func (r *run) appeal(explanation string) error {
+	if r.Flag == "" {
+		return errors.New("Run is not flagged.")
+	}
+	if r.Appeal != "" {
+		return errors.New("The flag on this run has already been appealed.")
+	}
+	err := db.appeal(r.ID, explanation)
+	if err != nil {
+		return errors.New("Could not perform database query: " + err.Error())
+	}
+	mailBody := "Hi Moss Tier moderator. %s has appealed the flag on their " +
+		"run in the category %s (id %d). The run was flagged for the reason " +
+		"\"%s\", and the explanation they gave was \"%s\". You can unflag " +
+		"the run or dismiss the appeal on the moderation page."
+	err = sendMails(getModeratorEmails(r.Category), "Moss Tier flag appealed",
+		fmt.Sprintf(mailBody, r.Runner.Username, r.Category.Name, r.ID, r.Flag, explanation))
+	if err != nil {
+		return errors.New("Stored appeal but could not inform moderators: " + err.Error())
+	}
+	return nil
+}
+
+// dismissAppeal keeps the flag on the run after the runner appealed it, on
+// behalf of a given moderator, and informs the runner.
+func (r *run) dismissAppeal(moderator runner) error {
+	if r.Appeal == "" || r.AppealDismissed {
+		return errors.New("Run has no open appeal.")
+	}
+	err := db.dismissAppeal(r.ID)
+	if err != nil {
+		return errors.New("Could not perform database query: " + err.Error())
+	}
+	logRunAction(moderator, auditDismissAppeal, *r, r.Appeal)
+	mailBody := "Hi %s.\n\nThis is to inform you that one of the Moss Tier " +
+		"moderators has looked at your appeal of the flag on your run in the " +
+		"category %s, and has decided to keep the flag."
+	err = r.Runner.sendMail("Moss Tier appeal dismissed",
+		fmt.Sprintf(mailBody, r.Runner.Username, r.Category.Name))
 	if err != nil {
+		return errors.New("Dismissed appeal but could not inform user: " + err.Error())
+	}
+	return nil
+}
+
+// notifyWorldRecord informs all users who have asked for it that the
+// run is a new world record. The mails are sent in the background, so
+// errors are logged rather than returned.
+func (r *run) notifyWorldRecord() {
+	subscribers, err := getWorldRecordSubscribers(r.Category)
+	if err != nil {
+		log.Println("Could not get world record subscribers: ", err)
 		return
 	}
-	_, err = query.Exec(r.ID)
-	return
+	mailBody := "Hi %s.\n\nA new world record has been set on Moss Tier! In the " +
+		"category %s, %s got %s (level %s). The video is here:\n\n%s\n\n" +
+		"You are receiving this mail because you asked to be notified about " +
+		"new world records. You can change this by editing your profile."
+	record := *r
+	go func() {
+		for _, subscriber := range subscribers {
+			if subscriber.ID == record.Runner.ID {
+				continue
+			}
+			err := subscriber.sendMail("New Moss Tier world record: "+record.Category.Name,
+				fmt.Sprintf(mailBody, subscriber.Username, record.Category.Name,
+					record.Runner.Username, record.FormatScore(), record.FormatLevel(), record.Link))
+			if err != nil {
+				log.Println("Could not notify "+subscriber.Username+" about world record: ", err)
+			}
+		}
+	}()
+}
+
+// deleteFromDatabase removes the run from the database on behalf of a
+// given runner.
+func (r *run) deleteFromDatabase(actor runner) error {
+	err := db.deleteRun(r.ID)
+	if err != nil {
+		return err
+	}
+	logRunAction(actor, auditDeleteRun, *r, "")
+	return nil
 }
 
 // GetWorld returns the last world, the player was in during the run
@@ -261,6 +524,38 @@ func (r *run) FormatScore() string {
 		r.NumberOfMilliseconds())
 }
 
+// IsWorldRecord returns true iff the run is the current world record in its
+// category. Of runs tied for first place, only the earliest is the record.
+func (r *run) IsWorldRecord() bool {
+	return r.RankInCategory == 1 && r.TieBreak <= 1
+}
+
+// FormatTieBreak describes the position of the run among the runs sharing
+// its rank, as in "2nd submitted", or returns the empty string if it has no
+// ties.
+func (r *run) FormatTieBreak() string {
+	if r.TieBreak == 0 {
+		return ""
+	}
+	suffix := "th"
+	if r.TieBreak%100 < 11 || r.TieBreak%100 > 13 {
+		switch r.TieBreak % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return fmt.Sprintf("%d%s submitted", r.TieBreak, suffix)
+}
+
+// IsObsolete returns true iff the run has been superseded by a newer run.
+func (r *run) IsObsolete() bool {
+	return !r.Obsoleted.IsZero()
+}
+
 // FormatTime formats the time of the run.
 func (r *run) FormatTime() string {
 	return r.Time.Format("2006-01-02")
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSharedRanks(t *testing.T) {
+	tests := []struct {
+		values []int
+		ranks  []int
+	}{
+		{[]int{}, []int{}},
+		{[]int{5}, []int{1}},
+		{[]int{5, 4, 3}, []int{1, 2, 3}},
+		{[]int{5, 5, 3}, []int{1, 1, 3}},
+		{[]int{5, 4, 4, 4, 1}, []int{1, 2, 2, 2, 5}},
+		{[]int{1, 1, 1}, []int{1, 1, 1}},
+	}
+	for _, test := range tests {
+		ranks := sharedRanks(len(test.values), func(i, j int) bool {
+			return test.values[i] == test.values[j]
+		})
+		if !reflect.DeepEqual(ranks, test.ranks) {
+			t.Errorf("sharedRanks(%v) = %v, want %v", test.values, ranks, test.ranks)
+		}
+	}
+}
+
+func TestRankRuns(t *testing.T) {
+	scoreCategory := category{ID: 1, Goal: "Score"}
+	timeCategory := category{ID: 2, Goal: "Time"}
+	// Runs are given by ID, result and time of submission, and expected back
+	// by ID, rank and tie-break.
+	type entry struct{ id, score, time int }
+	type ranked struct{ id, rank, tieBreak int }
+	tests := []struct {
+		name string
+		cat  category
+		runs []entry
+		want []ranked
+	}{
+		{"no runs", scoreCategory, nil, []ranked{}},
+		{"no ties", scoreCategory,
+			[]entry{{1, 10, 0}, {2, 30, 0}, {3, 20, 0}},
+			[]ranked{{2, 1, 0}, {3, 2, 0}, {1, 3, 0}}},
+		{"tied record", scoreCategory,
+			[]entry{{1, 10, 0}, {2, 30, 5}, {3, 30, 1}, {4, 20, 0}},
+			[]ranked{{3, 1, 1}, {2, 1, 2}, {4, 3, 0}, {1, 4, 0}}},
+		{"lower times are better", timeCategory,
+			[]entry{{1, 5000, 3}, {2, 4000, 5}, {3, 5000, 1}, {4, 5000, 1}, {5, 6000, 0}},
+			[]ranked{{2, 1, 0}, {3, 2, 1}, {4, 2, 2}, {1, 2, 3}, {5, 5, 0}}},
+	}
+	for _, test := range tests {
+		var runs []run
+		for _, e := range test.runs {
+			runs = append(runs, run{ID: e.id, Score: e.score, Category: test.cat,
+				Time: time.Unix(int64(e.time), 0)})
+		}
+		rankRuns(runs, test.cat)
+		got := []ranked{}
+		for _, r := range runs {
+			got = append(got, ranked{r.ID, r.RankInCategory, r.TieBreak})
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// addRankingRuns fills the test store with runs by ana and bob from DK,
+// cid from SE and dan without a country:
+//
+//	score:     ana 1000 (1st), bob 1000 (1st, submitted later), cid 900 (3rd)
+//	any%:      cid 5000 (1st), dan 6000 (2nd)
+//	challenge: ana 100 (1st), dan 200 (2nd)
+//
+// Superseded, pending and flagged runs are added as well, and must not count.
+func addRankingRuns(t *testing.T) (s *sqlStore, ana, bob, cid, dan runner) {
+	s = useTestStore(t)
+	readCountries()
+	previous := config.Points
+	config.Points = pointsConfig{Formula: pointsFormulaRank, MaxPoints: 10}
+	t.Cleanup(func() { config.Points = previous })
+	score, _ := getCategoryByAbbr("score")
+	anyPercent, _ := getCategoryByAbbr("any")
+	challenge := getChallengeCategories()[0]
+
+	ana = addTestRunner(t, "ana")
+	bob = addTestRunner(t, "bob")
+	cid = addTestRunner(t, "cid")
+	dan = addTestRunner(t, "dan")
+	for _, r := range []*runner{&ana, &bob, &cid} {
+		r.Country = map[string]string{"ana": "DK", "bob": "DK", "cid": "SE"}[r.Username]
+		err := db.updateRunner(r, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	insertTestRun(t, s, ana.ID, score, 1000, 100, 100, 0)
+	insertTestRun(t, s, bob.ID, score, 1000, 200, 200, 0)
+	insertTestRun(t, s, cid.ID, score, 900, 150, 150, 0)
+	insertTestRun(t, s, cid.ID, anyPercent, 5000, 100, 100, 0)
+	insertTestRun(t, s, dan.ID, anyPercent, 6000, 100, 100, 0)
+	insertTestRun(t, s, ana.ID, challenge, 100, 100, 100, 0)
+	insertTestRun(t, s, dan.ID, challenge, 200, 100, 100, 0)
+
+	insertTestRun(t, s, bob.ID, anyPercent, 1000, 50, 50, 90)
+	insertTestRun(t, s, bob.ID, challenge, 50, 300, 0, 0)
+	flagged := insertTestRun(t, s, dan.ID, score, 5000, 300, 300, 0)
+	_, err := s.db.Exec("UPDATE runs SET flag = 'Fake' WHERE id = ?", flagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestGetFilteredRunsLimit(t *testing.T) {
+	_, ana, bob, cid, _ := addRankingRuns(t)
+	score, _ := getCategoryByAbbr("score")
+	type ranked struct{ runnerID, rank, tieBreak int }
+	tests := []struct {
+		limit int64
+		want  []ranked
+	}{
+		// The tie with bob is only seen by fetching a run more than asked.
+		{1, []ranked{{ana.ID, 1, 1}}},
+		{2, []ranked{{ana.ID, 1, 1}, {bob.ID, 1, 2}}},
+		{3, []ranked{{ana.ID, 1, 1}, {bob.ID, 1, 2}, {cid.ID, 3, 0}}},
+		{4, []ranked{{ana.ID, 1, 1}, {bob.ID, 1, 2}, {cid.ID, 3, 0}}},
+		{0, []ranked{{ana.ID, 1, 1}, {bob.ID, 1, 2}, {cid.ID, 3, 0}}},
+	}
+	for _, test := range tests {
+		runs, err := getFilteredRuns(score, runFilter{}, test.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []ranked{}
+		for _, r := range runs {
+			got = append(got, ranked{r.Runner.ID, r.RankInCategory, r.TieBreak})
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("limit %d: got %v, want %v", test.limit, got, test.want)
+		}
+	}
+}
+
+func TestHypotheticalRank(t *testing.T) {
+	_, ana, bob, cid, dan := addRankingRuns(t)
+	score, _ := getCategoryByAbbr("score")
+	anyPercent, _ := getCategoryByAbbr("any")
+	tests := []struct {
+		name     string
+		cat      category
+		result   int
+		runnerID int
+		rank     int
+		tied     bool
+	}{
+		{"new record", score, 1100, cid.ID, 1, false},
+		{"tying the record", score, 1000, cid.ID, 1, true},
+		{"tying the record, already tied", score, 1000, ana.ID, 1, true},
+		{"improving a tied record", score, 1001, bob.ID, 1, false},
+		{"behind ties", score, 950, dan.ID, 3, false},
+		{"last", score, 10, dan.ID, 4, false},
+		{"improving an own record", anyPercent, 4000, cid.ID, 1, false},
+		{"resubmitting an own record", anyPercent, 5000, cid.ID, 1, false},
+		{"worsening an own record", anyPercent, 5500, cid.ID, 1, false},
+		{"replacing a worse run", anyPercent, 5500, dan.ID, 2, false},
+		{"new runner", anyPercent, 6000, ana.ID, 2, true},
+	}
+	for _, test := range tests {
+		rank, tied, err := hypotheticalRank(test.result, test.runnerID, test.cat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rank != test.rank || tied != test.tied {
+			t.Errorf("%s: got rank %d, tied %t, want rank %d, tied %t",
+				test.name, rank, tied, test.rank, test.tied)
+		}
+	}
+}
+
+func TestUnflag(t *testing.T) {
+	// Ana has a current run and a flagged run in any%, and bob holds the
+	// record with 5000. The flagged run is current unless superseded is set.
+	tests := []struct {
+		name       string
+		current    int
+		flagged    int
+		superseded bool
+		reinstated bool
+		record     bool
+	}{
+		{"not superseded", 0, 4000, false, true, true},
+		{"not superseded, no record", 0, 6000, false, true, false},
+		{"superseded by a worse run", 5500, 4000, true, true, true},
+		{"superseded by a better run", 4500, 6000, true, false, false},
+		{"superseded by an equal run", 6000, 6000, true, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := useTestStore(t)
+			anyPercent, _ := getCategoryByAbbr("any")
+			moderator := addTestRunner(t, "mod")
+			ana := addTestRunner(t, "ana")
+			bob := addTestRunner(t, "bob")
+			record := insertTestRun(t, s, bob.ID, anyPercent, 5000, 100, 100, 0)
+			var obsoleted int64
+			if test.superseded {
+				obsoleted = 300
+			}
+			flagged := insertTestRun(t, s, ana.ID, anyPercent, test.flagged, 200, 200, obsoleted)
+			execTestSQL(t, s, "UPDATE runs SET flag = 'Fake' WHERE id = ?", flagged)
+			current := 0
+			if test.current != 0 {
+				current = insertTestRun(t, s, ana.ID, anyPercent, test.current, 300, 300, 0)
+			}
+
+			r, err := getRunByID(flagged)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = r.unflag(moderator)
+			if err != nil {
+				t.Fatal(err)
+			}
+			runs, err := getRunsByCategory(anyPercent, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			onLeaderboards := make(map[int]bool)
+			for _, r := range runs {
+				onLeaderboards[r.ID] = true
+			}
+			if onLeaderboards[flagged] != test.reinstated {
+				t.Errorf("unflagged run on the leaderboards: %t, want %t", onLeaderboards[flagged], test.reinstated)
+			}
+			if current != 0 && onLeaderboards[current] == test.reinstated {
+				t.Errorf("current run on the leaderboards: %t, want %t", onLeaderboards[current], !test.reinstated)
+			}
+			if !onLeaderboards[record] {
+				t.Error("run by another runner left the leaderboards")
+			}
+			if (runs[0].ID == flagged) != test.record {
+				t.Errorf("the record is run %d", runs[0].ID)
+			}
+			var newRecords int
+			err = s.db.QueryRow("SELECT COUNT(*) FROM newWR WHERE runid = ?", flagged).Scan(&newRecords)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (newRecords == 1) != test.record {
+				t.Errorf("unflagged run listed %d times as a new world record", newRecords)
+			}
+		})
+	}
+}
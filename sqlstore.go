@@ -0,0 +1,879 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// sqlStore is a store backed by an SQL database. The queries are written
+// to work with both MySQL and SQLite; the two differ only in how they are
+// opened and in their migrations (see store_mysql.go and store_sqlite.go).
+type sqlStore struct {
+	db         *sql.DB
+	migrations []migration
+}
+
+// unixTimeOrZero turns a Unix time from the database into a time, taking
+// 0 to mean that no time is set.
+func unixTimeOrZero(unixTime int64) time.Time {
+	if unixTime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(unixTime, 0)
+}
+
+// runnerColumns are the columns of the users table read by selectRunner
+// and selectRunners, in the order expected by scanRunner.
+const runnerColumns = "id, username, pass, email, emailVerified, country, spelunker, steam, steamVerified, psn, xbla, twitch, youtube, freetext, emailflag, emailwr, emailChallenge, role"
+
+// scanRunner reads a runner from a row of runnerColumns.
+func scanRunner(row interface {
+	Scan(dest ...interface{}) error
+}) (r runner, err error) {
+	var spelunkerID int
+	err = row.Scan(&r.ID, &r.Username, &r.Password, &r.Email, &r.EmailVerified, &r.Country, &spelunkerID, &r.Steam, &r.SteamVerified, &r.Psn, &r.Xbla, &r.Twitch, &r.YouTube, &r.FreeText, &r.EmailFlag, &r.EmailWr, &r.EmailChallenge, &r.Role)
+	r.Spelunker, _ = getSpelunkerByID(spelunkerID)
+	return
+}
+
+func (s *sqlStore) getRunsByCategory(category category, filter runFilter, limit int64) (runs []run, err error) {
+	query := "SELECT runs.id, runs.score, runs.level, runs.link, runs.platform, runs.spelunker, runs.date, runs.comment, users.id, users.username, users.country FROM runs INNER JOIN users ON runs.runner = users.id WHERE runs.cat = ? AND runs.flag = '' AND runs.pending = 0 AND runs.obsoleted = 0"
+	arguments := []interface{}{category.ID}
+	if filter.Platform.ID != 0 {
+		query += " AND runs.platform = ?"
+		arguments = append(arguments, filter.Platform.ID)
+	}
+	if filter.Spelunker != nil {
+		query += " AND runs.spelunker = ?"
+		arguments = append(arguments, filter.Spelunker.ID)
+	}
+	if filter.Country != "" {
+		query += " AND users.country = ?"
+		arguments = append(arguments, filter.Country)
+	}
+	if !filter.From.IsZero() {
+		query += " AND runs.date >= ?"
+		arguments = append(arguments, filter.From.Unix())
+	}
+	if !filter.To.IsZero() {
+		// The last day is included in full.
+		query += " AND runs.date < ?"
+		arguments = append(arguments, filter.To.AddDate(0, 0, 1).Unix())
+	}
+	query += " ORDER BY runs.score"
+	if category.Goal == "Score" {
+		query += " DESC"
+	}
+	// Ties are broken by time of submission; see rankRuns.
+	query += ", runs.date, runs.id"
+	if limit != 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	statement, err := s.db.Prepare(query)
+	if err != nil {
+		return
+	}
+	defer statement.Close()
+	rows, err := statement.Query(arguments...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r run
+		var p runner
+		var spelunkerID int
+		var platformID int
+		var unixTime int64
+		err = rows.Scan(&r.ID, &r.Score, &r.Level, &r.Link, &platformID, &spelunkerID, &unixTime, &r.Comment, &p.ID, &p.Username, &p.Country)
+		if err != nil {
+			return
+		}
+		r.Runner = p
+		r.Category = category
+		r.Spelunker, _ = getSpelunkerByID(spelunkerID)
+		r.Platform, _ = getPlatformByID(platformID)
+		r.Time = time.Unix(unixTime, 0)
+		runs = append(runs, r)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *sqlStore) getRunHistoryByCategory(category category) (runs []run, err error) {
+	rows, err := s.db.Query("SELECT runs.id, runs.score, runs.level, runs.link, runs.platform, runs.spelunker, runs.date, runs.obsoleted, runs.approved, runs.comment, users.id, users.username, users.country FROM runs INNER JOIN users ON runs.runner = users.id WHERE runs.cat = ? AND runs.flag = '' AND runs.pending = 0 ORDER BY runs.approved, runs.id", category.ID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r run
+		var spelunkerID int
+		var platformID int
+		var unixTime int64
+		var obsoleted int64
+		var approved int64
+		err = rows.Scan(&r.ID, &r.Score, &r.Level, &r.Link, &platformID, &spelunkerID, &unixTime, &obsoleted, &approved, &r.Comment, &r.Runner.ID, &r.Runner.Username, &r.Runner.Country)
+		if err != nil {
+			return
+		}
+		r.Category = category
+		r.Spelunker, _ = getSpelunkerByID(spelunkerID)
+		r.Platform, _ = getPlatformByID(platformID)
+		r.Time = time.Unix(unixTime, 0)
+		r.Obsoleted = unixTimeOrZero(obsoleted)
+		r.Approved = unixTimeOrZero(approved)
+		runs = append(runs, r)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *sqlStore) getRunsByRunnerID(runnerID int) (runs []run, err error) {
+	runner, err := s.getRunnerByID(runnerID)
+	if err != nil {
+		return
+	}
+	query := "SELECT id, cat, score, level, link, platform, spelunker, date, obsoleted, comment, flag, pending, appeal, appealed, appealDismissed FROM runs WHERE runner = ? ORDER BY cat, date, id"
+	statement, err := s.db.Prepare(query)
+	if err != nil {
+		return
+	}
+	defer statement.Close()
+	rows, err := statement.Query(runnerID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r run
+		var spelunkerID int
+		var platformID int
+		var categoryID int
+		var unixTime int64
+		var obsoleted int64
+		var appealed int64
+		err = rows.Scan(&r.ID, &categoryID, &r.Score, &r.Level, &r.Link, &platformID, &spelunkerID, &unixTime, &obsoleted, &r.Comment, &r.Flag, &r.Pending, &r.Appeal, &appealed, &r.AppealDismissed)
+		if err != nil {
+			return
+		}
+		r.Runner = runner
+		r.Category, _ = getCategoryByID(categoryID)
+		r.Spelunker, _ = getSpelunkerByID(spelunkerID)
+		r.Platform, _ = getPlatformByID(platformID)
+		r.Time = time.Unix(unixTime, 0)
+		r.Obsoleted = unixTimeOrZero(obsoleted)
+		r.Appealed = unixTimeOrZero(appealed)
+		runs = append(runs, r)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *sqlStore) getRunByID(runID int) (r run, err error) {
+	stmt, err := s.db.Prepare("SELECT score, cat, level, link, platform, spelunker, date, obsoleted, approved, comment, flag, pending, appeal, appealed, appealDismissed, runner FROM runs WHERE id = ?")
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+	var categoryID int
+	var spelunkerID int
+	var platformID int
+	var unixTime int64
+	var obsoleted int64
+	var approved int64
+	var appealed int64
+	err = stmt.QueryRow(runID).Scan(&r.Score, &categoryID, &r.Level, &r.Link, &platformID, &spelunkerID, &unixTime, &obsoleted, &approved, &r.Comment, &r.Flag, &r.Pending, &r.Appeal, &appealed, &r.AppealDismissed, &r.Runner.ID)
+	if err != nil {
+		return
+	}
+	r.Runner, _ = s.getRunnerByID(r.Runner.ID)
+	r.ID = runID
+	r.Category, _ = getCategoryByID(categoryID)
+	r.Spelunker, _ = getSpelunkerByID(spelunkerID)
+	r.Platform, _ = getPlatformByID(platformID)
+	r.Time = time.Unix(unixTime, 0)
+	r.Obsoleted = unixTimeOrZero(obsoleted)
+	r.Approved = unixTimeOrZero(approved)
+	r.Appealed = unixTimeOrZero(appealed)
+	return
+}
+
+func (s *sqlStore) flag(runID int, reason string) error {
+	// A new flag can be appealed anew.
+	_, err := s.db.Exec("UPDATE runs SET flag = ?, appeal = '', appealed = 0, appealDismissed = 0 WHERE id = ?", reason, runID)
+	return err
+}
+
+func (s *sqlStore) unflag(runID int) error {
+	_, err := s.db.Exec("UPDATE runs SET flag = '', appeal = '', appealed = 0, appealDismissed = 0 WHERE id = ?", runID)
+	return err
+}
+
+func (s *sqlStore) appeal(runID int, explanation string) error {
+	_, err := s.db.Exec("UPDATE runs SET appeal = ?, appealed = ? WHERE id = ? AND flag != ''", explanation, time.Now().Unix(), runID)
+	return err
+}
+
+func (s *sqlStore) dismissAppeal(runID int) error {
+	_, err := s.db.Exec("UPDATE runs SET appealDismissed = 1 WHERE id = ?", runID)
+	return err
+}
+
+func (s *sqlStore) getAppealedRuns() (runs []run, err error) {
+	rows, err := s.db.Query("SELECT id FROM runs WHERE flag != '' AND appeal != '' AND appealDismissed = 0 ORDER BY appealed")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	var runIDs []int
+	for rows.Next() {
+		var runID int
+		err = rows.Scan(&runID)
+		if err != nil {
+			return
+		}
+		runIDs = append(runIDs, runID)
+	}
+	err = rows.Err()
+	if err != nil {
+		return
+	}
+	// As in getPendingRuns, we are done with the rows before looking
+	// up anything else.
+	rows.Close()
+	for _, runID := range runIDs {
+		var r run
+		r, err = s.getRunByID(runID)
+		if err != nil {
+			return
+		}
+		runs = append(runs, r)
+	}
+	return
+}
+
+func (s *sqlStore) deleteRun(runID int) error {
+	_, err := s.db.Exec("DELETE FROM runs WHERE id = ?", runID)
+	return err
+}
+
+func (s *sqlStore) replaceRun(r *run, isWorldRecord bool) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	// Everything below must go through tx; with SQLite, there is only
+	// one connection, and it is busy with the transaction.
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	currentTime := time.Now().Unix()
+	// Pending runs only replace other pending runs; the runs on the
+	// leaderboards are replaced once the new run is approved.
+	_, err = tx.Exec("DELETE FROM runs WHERE runner = ? AND cat = ? AND pending = 1", r.Runner.ID, r.Category.ID)
+	if err != nil {
+		return
+	}
+	if !r.Pending {
+		err = obsoleteRunsByCategory(tx, r.Runner.ID, r.Category, currentTime)
+		if err != nil {
+			return
+		}
+	}
+	var approved int64
+	if !r.Pending {
+		approved = currentTime
+	}
+	result, err := tx.Exec("INSERT INTO runs (runner, cat, score, level, link, platform, spelunker, date, comment, flag, pending, approved) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, '', ?, ?)",
+		r.Runner.ID, r.Category.ID, r.Score, r.Level, r.Link, r.Platform.ID, r.Spelunker.ID, currentTime, r.Comment, r.Pending, approved)
+	if err != nil {
+		return
+	}
+	runID, err := result.LastInsertId()
+	if err != nil {
+		return
+	}
+	if isWorldRecord {
+		_, err = tx.Exec("INSERT INTO newWR (runid) VALUES (?)", runID)
+		if err != nil {
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+	r.ID = int(runID)
+	r.Time = time.Unix(currentTime, 0)
+	return
+}
+
+func (s *sqlStore) getPendingRuns() (runs []run, err error) {
+	rows, err := s.db.Query("SELECT id, cat, score, level, link, platform, spelunker, date, comment, runner FROM runs WHERE pending = 1 AND flag = '' ORDER BY date")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r run
+		var spelunkerID int
+		var platformID int
+		var categoryID int
+		var unixTime int64
+		err = rows.Scan(&r.ID, &categoryID, &r.Score, &r.Level, &r.Link, &platformID, &spelunkerID, &unixTime, &r.Comment, &r.Runner.ID)
+		if err != nil {
+			return
+		}
+		r.Category, _ = getCategoryByID(categoryID)
+		r.Spelunker, _ = getSpelunkerByID(spelunkerID)
+		r.Platform, _ = getPlatformByID(platformID)
+		r.Time = time.Unix(unixTime, 0)
+		r.Pending = true
+		runs = append(runs, r)
+	}
+	err = rows.Err()
+	if err != nil {
+		return
+	}
+	// The runners can only be looked up once we are done with the rows,
+	// as SQLite stores only have a single connection.
+	rows.Close()
+	for i := range runs {
+		runs[i].Runner, err = s.getRunnerByID(runs[i].Runner.ID)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *sqlStore) approveRun(r *run, isWorldRecord bool) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	_, err = tx.Exec("DELETE FROM runs WHERE runner = ? AND cat = ? AND pending = 1 AND id != ?", r.Runner.ID, r.Category.ID, r.ID)
+	if err != nil {
+		return
+	}
+	currentTime := time.Now().Unix()
+	err = obsoleteRunsByCategory(tx, r.Runner.ID, r.Category, currentTime)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec("UPDATE runs SET pending = 0, approved = ? WHERE id = ?", currentTime, r.ID)
+	if err != nil {
+		return
+	}
+	if isWorldRecord {
+		_, err = tx.Exec("INSERT INTO newWR (runid) VALUES (?)", r.ID)
+		if err != nil {
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+	r.Pending = false
+	return
+}
+
+func (s *sqlStore) reinstateRun(r *run, isWorldRecord bool) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	err = obsoleteRunsByCategory(tx, r.Runner.ID, r.Category, time.Now().Unix())
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec("UPDATE runs SET obsoleted = 0 WHERE id = ?", r.ID)
+	if err != nil {
+		return
+	}
+	if isWorldRecord {
+		_, err = tx.Exec("INSERT INTO newWR (runid) VALUES (?)", r.ID)
+		if err != nil {
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+	r.Obsoleted = time.Time{}
+	return
+}
+
+func (s *sqlStore) getRunnerByID(id int) (runner, error) {
+	return s.selectRunner("WHERE id = ?", id)
+}
+
+func (s *sqlStore) getRunnerByUsername(username string) (runner, error) {
+	return s.selectRunner("WHERE username = ?", username)
+}
+
+func (s *sqlStore) getRunnerByUsernameAndEmail(username, email string) (runner, error) {
+	return s.selectRunner("WHERE username = ? AND email = ?", username, email)
+}
+
+func (s *sqlStore) getRunnerBySteam(steamID int) (runner, error) {
+	return s.selectRunner("WHERE steam = ? AND steamVerified = 1", steamID)
+}
+
+func (s *sqlStore) getWorldRecordSubscribers(main bool) ([]runner, error) {
+	if main {
+		return s.selectRunners("WHERE emailwr = 1 AND email != '' AND emailVerified = 1")
+	}
+	return s.selectRunners("WHERE emailChallenge = 1 AND email != '' AND emailVerified = 1")
+}
+
+func (s *sqlStore) getStaff() ([]runner, error) {
+	return s.selectRunners("WHERE role != ? ORDER BY username", roleRunner)
+}
+
+// selectRunner returns the runner matching a given filter on the users
+// table, such as "WHERE id = ?". The filter never comes from users.
+func (s *sqlStore) selectRunner(constraints string, values ...interface{}) (r runner, err error) {
+	query := "SELECT " + runnerColumns + " FROM users " + constraints
+	statement, err := s.db.Prepare(query)
+	if err != nil {
+		return
+	}
+	defer statement.Close()
+	r, err = scanRunner(statement.QueryRow(values...))
+	if err != nil || r.Role != roleModerator {
+		return
+	}
+	rows, err := s.db.Query("SELECT cat FROM moderatorscopes WHERE runner = ?", r.ID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var categoryID int
+		err = rows.Scan(&categoryID)
+		if err != nil {
+			return
+		}
+		r.ModeratedCategories = append(r.ModeratedCategories, categoryID)
+	}
+	err = rows.Err()
+	return
+}
+
+// selectRunners returns all runners matching a given filter.
+func (s *sqlStore) selectRunners(constraints string, values ...interface{}) (runners []runner, err error) {
+	query := "SELECT " + runnerColumns + " FROM users " + constraints
+	statement, err := s.db.Prepare(query)
+	if err != nil {
+		return
+	}
+	defer statement.Close()
+	rows, err := statement.Query(values...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r runner
+		r, err = scanRunner(rows)
+		if err != nil {
+			return
+		}
+		runners = append(runners, r)
+	}
+	err = rows.Err()
+	if err != nil {
+		return
+	}
+	// The scopes of the moderators can only be looked up once we are done
+	// with the rows, as SQLite stores only have a single connection.
+	rows.Close()
+	scopeRows, err := s.db.Query("SELECT runner, cat FROM moderatorscopes")
+	if err != nil {
+		return
+	}
+	defer scopeRows.Close()
+	for scopeRows.Next() {
+		var runnerID, categoryID int
+		err = scopeRows.Scan(&runnerID, &categoryID)
+		if err != nil {
+			return
+		}
+		for i := range runners {
+			if runners[i].ID == runnerID && runners[i].Role == roleModerator {
+				runners[i].ModeratedCategories = append(runners[i].ModeratedCategories, categoryID)
+			}
+		}
+	}
+	err = scopeRows.Err()
+	return
+}
+
+func (s *sqlStore) setRole(runnerID int, role string, categoryIDs []int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	_, err = tx.Exec("UPDATE users SET role = ? WHERE id = ?", role, runnerID)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec("DELETE FROM moderatorscopes WHERE runner = ?", runnerID)
+	if err != nil {
+		return
+	}
+	for _, categoryID := range categoryIDs {
+		_, err = tx.Exec("INSERT INTO moderatorscopes (runner, cat) VALUES (?, ?)", runnerID, categoryID)
+		if err != nil {
+			return
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) legacyImported(name string) (bool, error) {
+	var imported int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM legacyimports WHERE name = ?", name).Scan(&imported)
+	return imported > 0, err
+}
+
+func (s *sqlStore) markLegacyImported(name string) error {
+	_, err := s.db.Exec("INSERT INTO legacyimports (name, imported) VALUES (?, ?)", name, time.Now().Unix())
+	return err
+}
+
+func (s *sqlStore) makeUser(username, email, hashedPassword string) error {
+	_, err := s.db.Exec("INSERT INTO users (username, email, pass) VALUES (?, ?, ?)",
+		username, email, hashedPassword)
+	return err
+}
+
+func (s *sqlStore) updateRunner(r *runner, hashedPassword string) error {
+	query := "UPDATE users SET username = ?, email = ?, emailVerified = ?, country = ?, spelunker = ?, psn = ?, xbla = ?, twitch = ?, youtube = ?, freetext = ?, emailflag = ?, emailwr = ?, emailChallenge = ?"
+	values := []interface{}{r.Username, r.Email, r.EmailVerified, r.Country, r.Spelunker.ID, r.Psn, r.Xbla,
+		r.Twitch, r.YouTube, r.FreeText, r.EmailFlag, r.EmailWr, r.EmailChallenge}
+	if hashedPassword != "" {
+		query += ", pass = ?"
+		values = append(values, hashedPassword)
+	}
+	query += " WHERE id = ?"
+	values = append(values, r.ID)
+	_, err := s.db.Exec(query, values...)
+	return err
+}
+
+func (s *sqlStore) setSteam(runnerID int, steamID int) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	if steamID != 0 {
+		_, err = tx.Exec("UPDATE users SET steam = 0 WHERE steam = ? AND steamVerified = 0 AND id != ?", steamID, runnerID)
+		if err != nil {
+			return
+		}
+	}
+	_, err = tx.Exec("UPDATE users SET steam = ?, steamVerified = ? WHERE id = ?", steamID, steamID != 0, runnerID)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) updatePassword(username, hashedPassword string) error {
+	_, err := s.db.Exec("UPDATE users SET pass = ? WHERE username = ?", hashedPassword, username)
+	return err
+}
+
+func (s *sqlStore) obsoleteRunsByCategory(runnerID int, cat category) error {
+	return obsoleteRunsByCategory(s.db, runnerID, cat, time.Now().Unix())
+}
+
+// obsoleteRunsByCategory supersedes the current approved runs by a given
+// runner in a given category at a given Unix time, using either a database
+// or a transaction.
+func obsoleteRunsByCategory(execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, runnerID int, cat category, unixTime int64) error {
+	_, err := execer.Exec("UPDATE runs SET obsoleted = ? WHERE runner = ? AND cat = ? AND pending = 0 AND obsoleted = 0",
+		unixTime, runnerID, cat.ID)
+	return err
+}
+
+func (s *sqlStore) createSession(id string, runnerID int, expires time.Time) error {
+	_, err := s.db.Exec("INSERT INTO sessions (id, runner, created, expires) VALUES (?, ?, ?, ?)",
+		id, runnerID, time.Now().Unix(), expires.Unix())
+	return err
+}
+
+func (s *sqlStore) getSession(id string) (runnerID int, expires time.Time, err error) {
+	var unixTime int64
+	err = s.db.QueryRow("SELECT runner, expires FROM sessions WHERE id = ?", id).Scan(&runnerID, &unixTime)
+	expires = time.Unix(unixTime, 0)
+	return
+}
+
+func (s *sqlStore) deleteSession(id string) error {
+	_, err := s.db.Exec("DELETE FROM sessions WHERE id = ?", id)
+	return err
+}
+
+func (s *sqlStore) deleteSessionsByRunner(runnerID int, exceptID string) error {
+	_, err := s.db.Exec("DELETE FROM sessions WHERE runner = ? AND id != ?", runnerID, exceptID)
+	return err
+}
+
+func (s *sqlStore) deleteExpiredSessions() error {
+	_, err := s.db.Exec("DELETE FROM sessions WHERE expires < ?", time.Now().Unix())
+	return err
+}
+
+func (s *sqlStore) createPasswordReset(id string, runnerID int, expires time.Time) error {
+	_, err := s.db.Exec("INSERT INTO passwordresets (id, runner, created, expires) VALUES (?, ?, ?, ?)",
+		id, runnerID, time.Now().Unix(), expires.Unix())
+	return err
+}
+
+func (s *sqlStore) getPasswordReset(id string) (runnerID int, expires time.Time, err error) {
+	var unixTime int64
+	err = s.db.QueryRow("SELECT runner, expires FROM passwordresets WHERE id = ?", id).Scan(&runnerID, &unixTime)
+	expires = time.Unix(unixTime, 0)
+	return
+}
+
+func (s *sqlStore) deletePasswordResets(runnerID int) (int64, error) {
+	result, err := s.db.Exec("DELETE FROM passwordresets WHERE runner = ?", runnerID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *sqlStore) deleteExpiredPasswordResets() error {
+	_, err := s.db.Exec("DELETE FROM passwordresets WHERE expires < ?", time.Now().Unix())
+	return err
+}
+
+func (s *sqlStore) createEmailVerification(id string, runnerID int, email string, expires time.Time) error {
+	_, err := s.db.Exec("INSERT INTO emailverifications (id, runner, email, created, expires) VALUES (?, ?, ?, ?, ?)",
+		id, runnerID, email, time.Now().Unix(), expires.Unix())
+	return err
+}
+
+func (s *sqlStore) getEmailVerification(id string) (runnerID int, email string, expires time.Time, err error) {
+	var unixTime int64
+	err = s.db.QueryRow("SELECT runner, email, expires FROM emailverifications WHERE id = ?", id).Scan(&runnerID, &email, &unixTime)
+	expires = time.Unix(unixTime, 0)
+	return
+}
+
+func (s *sqlStore) verifyEmail(runnerID int, email string) error {
+	_, err := s.db.Exec("UPDATE users SET emailVerified = 1 WHERE id = ? AND email = ?", runnerID, email)
+	return err
+}
+
+func (s *sqlStore) deleteEmailVerifications(runnerID int) error {
+	_, err := s.db.Exec("DELETE FROM emailverifications WHERE runner = ?", runnerID)
+	return err
+}
+
+func (s *sqlStore) deleteExpiredEmailVerifications() error {
+	_, err := s.db.Exec("DELETE FROM emailverifications WHERE expires < ?", time.Now().Unix())
+	return err
+}
+
+func (s *sqlStore) saveDaily(date string, leaderboardID int, entries []dailyEntry) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	_, err = tx.Exec("DELETE FROM dailyentries WHERE date = ?", date)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec("DELETE FROM dailies WHERE date = ?", date)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec("INSERT INTO dailies (date, leaderboard, entries, fetched) VALUES (?, ?, ?, ?)",
+		date, leaderboardID, len(entries), time.Now().Unix())
+	if err != nil {
+		return
+	}
+	statement, err := tx.Prepare("INSERT INTO dailyentries (date, place, steam, score, level, spelunker) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return
+	}
+	defer statement.Close()
+	for _, e := range entries {
+		_, err = statement.Exec(date, e.Rank, e.Steam, e.Score, e.Level, e.Spelunker.ID)
+		if err != nil {
+			return
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) getDailies(limit int) (dailies []daily, err error) {
+	rows, err := s.db.Query(fmt.Sprintf("SELECT date, entries FROM dailies ORDER BY date DESC LIMIT %d", limit))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	dailies = []daily{}
+	for rows.Next() {
+		var d daily
+		var date string
+		err = rows.Scan(&date, &d.EntryCount)
+		if err != nil {
+			return
+		}
+		d.Date, err = parseDailyDate(date)
+		if err != nil {
+			return
+		}
+		dailies = append(dailies, d)
+	}
+	err = rows.Err()
+	return
+}
+
+// dailyEntryColumns are the columns read by scanDailyEntry, from
+// dailyentries joined with dailies and with users on linked Steam accounts.
+const dailyEntryColumns = "dailyentries.date, dailyentries.place, dailies.entries, dailyentries.steam, COALESCE(users.id, 0), COALESCE(users.username, ''), COALESCE(users.country, ''), dailyentries.score, dailyentries.level, dailyentries.spelunker FROM dailyentries INNER JOIN dailies ON dailyentries.date = dailies.date LEFT JOIN users ON users.steam = dailyentries.steam AND users.steamVerified = 1"
+
+// scanDailyEntry reads a daily entry from a row of dailyEntryColumns.
+func scanDailyEntry(row interface {
+	Scan(dest ...interface{}) error
+}) (e dailyEntry, err error) {
+	var date string
+	var spelunkerID int
+	err = row.Scan(&date, &e.Rank, &e.Total, &e.Steam, &e.Runner.ID, &e.Runner.Username, &e.Runner.Country, &e.Score, &e.Level, &spelunkerID)
+	if err != nil {
+		return
+	}
+	e.Date, err = parseDailyDate(date)
+	e.Spelunker, _ = getSpelunkerByID(spelunkerID)
+	return
+}
+
+func (s *sqlStore) getDailyEntries(date string, offset, limit int) (entries []dailyEntry, total int, err error) {
+	err = s.db.QueryRow("SELECT entries FROM dailies WHERE date = ?", date).Scan(&total)
+	if err != nil {
+		return
+	}
+	rows, err := s.db.Query(fmt.Sprintf("SELECT "+dailyEntryColumns+" WHERE dailyentries.date = ? ORDER BY dailyentries.place LIMIT %d OFFSET %d", limit, offset), date)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	entries = []dailyEntry{}
+	for rows.Next() {
+		var e dailyEntry
+		e, err = scanDailyEntry(rows)
+		if err != nil {
+			return
+		}
+		entries = append(entries, e)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *sqlStore) getDailyEntriesBySteam(steamID int, limit int) (entries []dailyEntry, err error) {
+	rows, err := s.db.Query(fmt.Sprintf("SELECT "+dailyEntryColumns+" WHERE dailyentries.steam = ? ORDER BY dailyentries.date DESC LIMIT %d", limit), steamID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	entries = []dailyEntry{}
+	for rows.Next() {
+		var e dailyEntry
+		e, err = scanDailyEntry(rows)
+		if err != nil {
+			return
+		}
+		entries = append(entries, e)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *sqlStore) addAuditEntry(e auditEntry) error {
+	_, err := s.db.Exec("INSERT INTO auditlog (actor, action, run, runner, cat, reason, date) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		e.Actor.ID, e.Action, e.RunID, e.Runner.ID, e.Category.ID, e.Reason, time.Now().Unix())
+	return err
+}
+
+func (s *sqlStore) getAuditLog(filter auditFilter, limit int) (entries []auditEntry, err error) {
+	query := "SELECT auditlog.id, auditlog.actor, COALESCE(actors.username, ''), auditlog.action, auditlog.run, auditlog.runner, COALESCE(targets.username, ''), auditlog.cat, auditlog.reason, auditlog.date FROM auditlog LEFT JOIN users AS actors ON auditlog.actor = actors.id LEFT JOIN users AS targets ON auditlog.runner = targets.id WHERE 1 = 1"
+	var values []interface{}
+	if filter.ActorID != 0 {
+		query += " AND auditlog.actor = ?"
+		values = append(values, filter.ActorID)
+	}
+	if filter.CategoryID != 0 {
+		query += " AND auditlog.cat = ?"
+		values = append(values, filter.CategoryID)
+	}
+	if filter.Action != "" {
+		query += " AND auditlog.action = ?"
+		values = append(values, filter.Action)
+	}
+	query += fmt.Sprintf(" ORDER BY auditlog.date DESC, auditlog.id DESC LIMIT %d", limit)
+	rows, err := s.db.Query(query, values...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e auditEntry
+		var categoryID int
+		var unixTime int64
+		err = rows.Scan(&e.ID, &e.Actor.ID, &e.Actor.Username, &e.Action, &e.RunID, &e.Runner.ID, &e.Runner.Username, &categoryID, &e.Reason, &unixTime)
+		if err != nil {
+			return
+		}
+		e.Category, _ = getCategoryByID(categoryID)
+		e.Time = time.Unix(unixTime, 0)
+		entries = append(entries, e)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *sqlStore) close() error {
+	return s.db.Close()
+}
@@ -4,68 +4,278 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-const scoreLeaderboards = "https://steamcommunity.com/stats/239350/leaderboards/164848/?xml=1"
-const speedLeaderboards = "https://steamcommunity.com/stats/239350/leaderboards/164849/?xml=1"
+// The Steam leaderboards of Spelunky are read through a steamClient, which
+// caches each leaderboard for a while, as reading a whole leaderboard takes
+// several requests to Steam. The client is configured in the config, and can
+// be pointed to a local stand-in for Steam for testing.
+type steamClient struct {
+	baseURL         string
+	appID           int
+	leaderboards    map[string]int
+	maxPages        int
+	cacheTTL        time.Duration
+	httpClient      *http.Client
+	dailyNameFormat string
+
+	// Each leaderboard has its own lock, so that only one request at a time
+	// reads it from Steam, while the others wait for the result.
+	mutexes map[string]*sync.Mutex
+	mutex   sync.Mutex
+	cache   map[string]cachedLeaderboard
+}
+
+// steamLeaderboardConfig configures the steamClient; zero values are
+// replaced by the defaults below.
+type steamLeaderboardConfig struct {
+	BaseURL            string `json:"baseURL"`
+	AppID              int    `json:"appID"`
+	ScoreLeaderboardID int    `json:"scoreLeaderboardID"`
+	SpeedLeaderboardID int    `json:"speedLeaderboardID"`
+	TimeoutSeconds     int    `json:"timeoutSeconds"`
+	CacheMinutes       int    `json:"cacheMinutes"`
+	MaxPages           int    `json:"maxPages"`
+	// DailyNameFormat is the name of the daily challenge leaderboards, as a
+	// Go time layout, and DailyFetchMinutes says how often to mirror them;
+	// a negative value turns off mirroring. See daily.go.
+	DailyNameFormat   string `json:"dailyNameFormat"`
+	DailyFetchMinutes int    `json:"dailyFetchMinutes"`
+}
+
+const (
+	defaultSteamBaseURL            = "https://steamcommunity.com"
+	defaultSteamAppID              = 239350
+	defaultSteamScoreLeaderboardID = 164848
+	defaultSteamSpeedLeaderboardID = 164849
+	defaultSteamTimeoutSeconds     = 10
+	defaultSteamCacheMinutes       = 10
+	defaultSteamMaxPages           = 20
+	defaultDailyNameFormat         = "01/02/2006 DAILY"
+	defaultDailyFetchMinutes       = 60
+	// maxSteamPageSize bounds how much we read of a page from Steam.
+	maxSteamPageSize = 16 << 20
+)
+
+var steamLeaderboards *steamClient
 
 type steamResponse struct {
-	XMLName xml.Name        `xml:"response"`
-	Entries []steamRunEntry `xml:"entries>entry"`
+	XMLName        xml.Name        `xml:"response"`
+	NextRequestURL string          `xml:"nextRequestURL"`
+	Entries        []steamRunEntry `xml:"entries>entry"`
 }
 
 type steamRunEntry struct {
 	SteamID string `xml:"steamid"`
 	Score   string `xml:"score"`
+	Rank    string `xml:"rank"`
 	Details string `xml:"details"`
 }
 
-// getResultFromSteamLeaderboards produces from a Steam user ID the best result
-// the given user has obtained in a run of a given type, if that user is in the
-// top 5000. It also returns the spelunker used for that run, as well as the final
-// level the user was in in that run.
-func getResultFromSteamLeaderboards(steamID int, runType string) (result int, level int, spelunker int, err error) {
-	result = -1
-	level = -1
-	spelunker = -1
+// steamLeaderboardList is the list of all leaderboards of the game.
+type steamLeaderboardList struct {
+	XMLName      xml.Name `xml:"response"`
+	Leaderboards []struct {
+		ID   int    `xml:"lbid"`
+		Name string `xml:"name"`
+	} `xml:"leaderboard"`
+}
+
+type cachedLeaderboard struct {
+	entries map[string]steamRunEntry
+	fetched time.Time
+}
+
+var errNotOnSteamLeaderboards = errors.New("Could not find you on the Steam leaderboards.")
 
-	var leaderboardsURL string
-	if runType == "score" {
-		leaderboardsURL = scoreLeaderboards
-	} else if runType == "speed" {
-		leaderboardsURL = speedLeaderboards
+// initializeSteamClient sets up steamLeaderboards from the config.
+func initializeSteamClient() {
+	c := config.SteamLeaderboards
+	if c.BaseURL == "" {
+		c.BaseURL = defaultSteamBaseURL
+	}
+	if c.AppID == 0 {
+		c.AppID = defaultSteamAppID
+	}
+	if c.ScoreLeaderboardID == 0 {
+		c.ScoreLeaderboardID = defaultSteamScoreLeaderboardID
+	}
+	if c.SpeedLeaderboardID == 0 {
+		c.SpeedLeaderboardID = defaultSteamSpeedLeaderboardID
+	}
+	if c.TimeoutSeconds <= 0 {
+		c.TimeoutSeconds = defaultSteamTimeoutSeconds
+	}
+	if c.CacheMinutes <= 0 {
+		c.CacheMinutes = defaultSteamCacheMinutes
 	}
+	if c.MaxPages <= 0 {
+		c.MaxPages = defaultSteamMaxPages
+	}
+	if c.DailyNameFormat == "" {
+		c.DailyNameFormat = defaultDailyNameFormat
+	}
+	steamLeaderboards = &steamClient{
+		baseURL:         strings.TrimSuffix(c.BaseURL, "/"),
+		appID:           c.AppID,
+		leaderboards:    map[string]int{"score": c.ScoreLeaderboardID, "speed": c.SpeedLeaderboardID},
+		maxPages:        c.MaxPages,
+		cacheTTL:        time.Duration(c.CacheMinutes) * time.Minute,
+		httpClient:      &http.Client{Timeout: time.Duration(c.TimeoutSeconds) * time.Second},
+		dailyNameFormat: c.DailyNameFormat,
+		mutexes:         map[string]*sync.Mutex{"score": {}, "speed": {}},
+		cache:           make(map[string]cachedLeaderboard),
+	}
+}
 
-	response, err := http.Get(leaderboardsURL)
+// getResult produces from a Steam user ID the best result the given user has
+// obtained in a run of a given type ("score" or "speed"). It also returns the
+// spelunker used for that run, as well as the final level the user was in in
+// that run.
+func (c *steamClient) getResult(steamID int, runType string) (result int, level int, spelunker int, err error) {
+	entries, err := c.getLeaderboard(runType)
 	if err != nil {
 		return
 	}
-	defer response.Body.Close()
-	contents, err := ioutil.ReadAll(response.Body)
-	xmlFromSteam := steamResponse{}
-	err = xml.Unmarshal(contents, &xmlFromSteam)
-	if err != nil {
+	entry, ok := entries[strconv.Itoa(steamID)]
+	if !ok {
+		err = errNotOnSteamLeaderboards
 		return
 	}
-	for _, entry := range xmlFromSteam.Entries {
-		if userID, _ := strconv.Atoi(entry.SteamID); userID == steamID {
-			result, _ = strconv.Atoi(entry.Score)
-			// The Steam "details" response is a string containing (hexadecimally represented)
-			// substrings describing the ending level and spelunker used in a given run.
-			spelunker64, _ := strconv.ParseInt(entry.Details[:2], 16, 64)
-			spelunker = int(spelunker64)
-			level64, _ := strconv.ParseInt(entry.Details[8:10], 16, 64)
-			level = int(level64)
-			return
+	return entry.parse()
+}
+
+// getLeaderboard returns the entries of the leaderboard of a given run type
+// by Steam ID, reading them from Steam unless they are cached.
+func (c *steamClient) getLeaderboard(runType string) (map[string]steamRunEntry, error) {
+	leaderboardID, ok := c.leaderboards[runType]
+	if !ok {
+		return nil, errors.New("Unknown run type.")
+	}
+	c.mutexes[runType].Lock()
+	defer c.mutexes[runType].Unlock()
+	c.mutex.Lock()
+	cached, ok := c.cache[runType]
+	c.mutex.Unlock()
+	if ok && time.Since(cached.fetched) < c.cacheTTL {
+		return cached.entries, nil
+	}
+	list, err := c.fetchLeaderboard(leaderboardID)
+	if err != nil {
+		log.Println("Could not read Steam leaderboard: ", err)
+		return nil, errors.New("Could not read the Steam leaderboards. Please try again later.")
+	}
+	entries := make(map[string]steamRunEntry)
+	for _, entry := range list {
+		// Entries are sorted, so we keep the first entry of each user.
+		if _, ok := entries[entry.SteamID]; !ok {
+			entries[entry.SteamID] = entry
+		}
+	}
+	c.mutex.Lock()
+	c.cache[runType] = cachedLeaderboard{entries, time.Now()}
+	c.mutex.Unlock()
+	return entries, nil
+}
+
+// fetchLeaderboard reads the entries of a leaderboard from Steam, best
+// first, following the links to the next pages for at most maxPages pages.
+func (c *steamClient) fetchLeaderboard(leaderboardID int) ([]steamRunEntry, error) {
+	var entries []steamRunEntry
+	pageURL := fmt.Sprintf("%s/stats/%d/leaderboards/%d/?xml=1", c.baseURL, c.appID, leaderboardID)
+	for page := 0; page < c.maxPages && pageURL != ""; page++ {
+		var response steamResponse
+		err := c.fetchXML(pageURL, &response)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, response.Entries...)
+		pageURL = strings.TrimSpace(response.NextRequestURL)
+		// We only follow links to where we are reading from anyway.
+		if len(response.Entries) == 0 || !strings.HasPrefix(pageURL, c.baseURL+"/") {
+			pageURL = ""
+		}
+	}
+	return entries, nil
+}
+
+// findLeaderboard returns the ID of the leaderboard with a given name.
+func (c *steamClient) findLeaderboard(name string) (int, error) {
+	var list steamLeaderboardList
+	err := c.fetchXML(fmt.Sprintf("%s/stats/%d/leaderboards/?xml=1", c.baseURL, c.appID), &list)
+	if err != nil {
+		return 0, err
+	}
+	for _, leaderboard := range list.Leaderboards {
+		if leaderboard.Name == name {
+			return leaderboard.ID, nil
 		}
 	}
-	err = errors.New("Steam ID not found in top 5000")
+	return 0, fmt.Errorf("no Steam leaderboard named %q", name)
+}
+
+// fetchDailyLeaderboard reads the entries of the daily challenge leaderboard
+// of a given day from Steam, best first, and returns the ID of the
+// leaderboard as well.
+func (c *steamClient) fetchDailyLeaderboard(day time.Time) (leaderboardID int, entries []steamRunEntry, err error) {
+	leaderboardID, err = c.findLeaderboard(day.Format(c.dailyNameFormat))
+	if err != nil {
+		return
+	}
+	entries, err = c.fetchLeaderboard(leaderboardID)
 	return
 }
 
+// fetchXML reads a page from Steam into a given value.
+func (c *steamClient) fetchXML(pageURL string, v interface{}) error {
+	httpResponse, err := c.httpClient.Get(pageURL)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode != http.StatusOK {
+		return fmt.Errorf("Steam answered %s for %s", httpResponse.Status, pageURL)
+	}
+	contents, err := ioutil.ReadAll(io.LimitReader(httpResponse.Body, maxSteamPageSize))
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(contents, v)
+}
+
+// parse reads the result, final level, and spelunker of a leaderboard entry.
+func (e steamRunEntry) parse() (result int, level int, spelunker int, err error) {
+	errUnreadable := errors.New("Could not read your run from the Steam leaderboards.")
+	result, err = strconv.Atoi(strings.TrimSpace(e.Score))
+	if err != nil {
+		return -1, -1, -1, errUnreadable
+	}
+	// The Steam "details" response is a string containing (hexadecimally represented)
+	// substrings describing the ending level and spelunker used in a given run.
+	details := strings.TrimSpace(e.Details)
+	if len(details) < 10 {
+		return -1, -1, -1, errUnreadable
+	}
+	spelunker64, err := strconv.ParseInt(details[:2], 16, 64)
+	if err != nil {
+		return -1, -1, -1, errUnreadable
+	}
+	level64, err := strconv.ParseInt(details[8:10], 16, 64)
+	if err != nil {
+		return -1, -1, -1, errUnreadable
+	}
+	return result, int(level64), int(spelunker64), nil
+}
+
 // steamLookupHandler handles POST requests to "/steam-lookup"
 func steamLookupHandler(w http.ResponseWriter, r *http.Request) {
 	type jsonResponse struct {
@@ -94,6 +304,10 @@ func parseSteamRequest(r *http.Request) (result int, level int, spelunker int, e
 		err = errors.New("Could not parse request.")
 		return
 	}
+	err = checkCSRFToken(r)
+	if err != nil {
+		return
+	}
 	runType, err := getFormValue(r, "runType")
 	if err != nil {
 		err = errors.New("Could not parse run type.")
@@ -108,10 +322,10 @@ func parseSteamRequest(r *http.Request) (result int, level int, spelunker int, e
 		err = errors.New("User not logged in.")
 		return
 	}
-	if user.Steam == 0 {
-		err = errors.New("User has no Steam ID.")
+	if !user.SteamVerified {
+		err = errors.New("User has not linked a Steam account.")
 		return
 	}
-	result, level, spelunker, err = getResultFromSteamLeaderboards(user.Steam, runType)
+	result, level, spelunker, err = steamLeaderboards.getResult(user.Steam, runType)
 	return
 }
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A fakeSteam serves endless leaderboards with one entry per page, where
+// the entry of page n has Steam ID n and score 1000-n.
+type fakeSteam struct {
+	server *httptest.Server
+	// nextHost is where the pages link to; it defaults to the fake itself.
+	nextHost string
+	// status, if set, is the answer to all requests.
+	status int
+	// hang makes the fake never answer.
+	hang bool
+
+	mutex    sync.Mutex
+	requests int
+}
+
+func newFakeSteam(t *testing.T) *fakeSteam {
+	steam := &fakeSteam{}
+	steam.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		steam.mutex.Lock()
+		steam.requests++
+		nextHost, status, hang := steam.nextHost, steam.status, steam.hang
+		steam.mutex.Unlock()
+		if hang {
+			<-r.Context().Done()
+			return
+		}
+		if status != 0 {
+			http.Error(w, "Unavailable", status)
+			return
+		}
+		if nextHost == "" {
+			nextHost = steam.server.URL
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<response>
+	<nextRequestURL><![CDATA[%s%s?xml=1&page=%d]]></nextRequestURL>
+	<entries>
+		<entry><steamid>%d</steamid><score>%d</score><rank>%d</rank><details><![CDATA[0300000010000000]]></details></entry>
+	</entries>
+</response>`, nextHost, r.URL.Path, page+1, page, 1000-page, page+1)
+	}))
+	t.Cleanup(steam.server.Close)
+	previous := config.SteamLeaderboards
+	config.SteamLeaderboards = steamLeaderboardConfig{BaseURL: steam.server.URL, MaxPages: 3}
+	initializeSteamClient()
+	t.Cleanup(func() { config.SteamLeaderboards = previous })
+	return steam
+}
+
+// configure changes the behaviour of the fake while it is serving.
+func (steam *fakeSteam) configure(change func(steam *fakeSteam)) {
+	steam.mutex.Lock()
+	defer steam.mutex.Unlock()
+	change(steam)
+}
+
+func (steam *fakeSteam) requestCount() int {
+	steam.mutex.Lock()
+	defer steam.mutex.Unlock()
+	return steam.requests
+}
+
+func TestSteamLeaderboardPages(t *testing.T) {
+	steam := newFakeSteam(t)
+	entries, err := steamLeaderboards.getLeaderboard("score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steam.requestCount() != 3 || len(entries) != 3 {
+		t.Errorf("read %d entries in %d requests, want 3 in 3", len(entries), steam.requestCount())
+	}
+	result, level, spelunker, err := steamLeaderboards.getResult(2, "score")
+	if err != nil || result != 998 || level != 16 || spelunker != 3 {
+		t.Errorf("getResult(2) = %d, %d, %d, %v", result, level, spelunker, err)
+	}
+	_, _, _, err = steamLeaderboards.getResult(3, "score")
+	if err != errNotOnSteamLeaderboards {
+		t.Errorf("found entry beyond the last page read: %v", err)
+	}
+}
+
+func TestSteamLeaderboardForeignNextPage(t *testing.T) {
+	foreign := newFakeSteam(t)
+	steam := newFakeSteam(t)
+	steam.configure(func(steam *fakeSteam) { steam.nextHost = foreign.server.URL })
+	entries, err := steamLeaderboards.getLeaderboard("score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || steam.requestCount() != 1 {
+		t.Errorf("read %d entries in %d requests, want 1 in 1", len(entries), steam.requestCount())
+	}
+	if foreign.requestCount() != 0 {
+		t.Error("followed a link to another host")
+	}
+}
+
+func TestSteamLeaderboardCache(t *testing.T) {
+	steam := newFakeSteam(t)
+	for i := 0; i < 2; i++ {
+		_, err := steamLeaderboards.getLeaderboard("score")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if steam.requestCount() != 3 {
+		t.Errorf("made %d requests, want the 3 of a single read", steam.requestCount())
+	}
+	// Other leaderboards are cached on their own.
+	_, err := steamLeaderboards.getLeaderboard("speed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steam.requestCount() != 6 {
+		t.Errorf("made %d requests, want 6", steam.requestCount())
+	}
+	// Expired leaderboards are read again.
+	cached := steamLeaderboards.cache["score"]
+	cached.fetched = time.Now().Add(-steamLeaderboards.cacheTTL)
+	steamLeaderboards.cache["score"] = cached
+	_, err = steamLeaderboards.getLeaderboard("score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steam.requestCount() != 9 {
+		t.Errorf("made %d requests, want 9", steam.requestCount())
+	}
+}
+
+func TestSteamLeaderboardErrors(t *testing.T) {
+	steam := newFakeSteam(t)
+	steam.configure(func(steam *fakeSteam) { steam.status = http.StatusServiceUnavailable })
+	_, err := steamLeaderboards.getLeaderboard("score")
+	if err == nil {
+		t.Error("read a leaderboard Steam did not serve")
+	}
+	if len(steamLeaderboards.cache) != 0 {
+		t.Error("cached a failed read")
+	}
+
+	steam.configure(func(steam *fakeSteam) {
+		steam.status = 0
+		steam.hang = true
+	})
+	steamLeaderboards.httpClient.Timeout = 50 * time.Millisecond
+	_, err = steamLeaderboards.getLeaderboard("score")
+	if err == nil {
+		t.Error("read a leaderboard Steam did not answer")
+	}
+
+	_, err = steamLeaderboards.getLeaderboard("daily")
+	if err == nil {
+		t.Error("read an unknown leaderboard")
+	}
+}
+
+func TestSteamRunEntryParse(t *testing.T) {
+	tests := []struct {
+		score     string
+		details   string
+		valid     bool
+		result    int
+		level     int
+		spelunker int
+	}{
+		{"123", "0300000010000000", true, 123, 16, 3},
+		{" 456 ", " 0a00000004 ", true, 456, 4, 10},
+		{"123", "030000001", false, 0, 0, 0},
+		{"123", "", false, 0, 0, 0},
+		{"123", "zz00000010", false, 0, 0, 0},
+		{"123", "03000000zz", false, 0, 0, 0},
+		{"", "0300000010", false, 0, 0, 0},
+		{"12x", "0300000010", false, 0, 0, 0},
+	}
+	for _, test := range tests {
+		entry := steamRunEntry{Score: test.score, Details: test.details}
+		result, level, spelunker, err := entry.parse()
+		if !test.valid {
+			if err == nil {
+				t.Errorf("parsed %+v", entry)
+			}
+			continue
+		}
+		if err != nil || result != test.result || level != test.level || spelunker != test.spelunker {
+			t.Errorf("parse(%+v) = %d, %d, %d, %v", entry, result, level, spelunker, err)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Runners sign in through Steam, and link their Steam accounts, using
+// OpenID 2.0: we send them to Steam, which sends them back to
+// "/steam-callback" with an assertion of their Steam ID, which we then have
+// Steam confirm. Only Steam IDs linked like this are used to log in and to
+// fill out runs from the Steam leaderboards; IDs typed in by runners before
+// linking existed are shown on profiles, but not trusted.
+const defaultSteamOpenIDEndpoint = "https://steamcommunity.com/openid/login"
+
+const openIDNamespace = "http://specs.openid.net/auth/2.0"
+
+// Steam identifies its users by claimed IDs of this form.
+var steamClaimedIDRegex = regexp.MustCompile(`^https?://steamcommunity\.com/openid/id/([0-9]+)$`)
+
+// The purposes of a trip to Steam.
+const (
+	steamPurposeLogin = "login"
+	steamPurposeLink  = "link"
+)
+
+var errSteamNotVerified = errors.New("Could not verify your Steam account. Please try again.")
+
+// steamOpenIDEndpoint returns the address of the OpenID provider, which
+// can be set in the config to test against a stand-in for Steam.
+func steamOpenIDEndpoint() string {
+	if config.SteamOpenIDEndpoint != "" {
+		return config.SteamOpenIDEndpoint
+	}
+	return defaultSteamOpenIDEndpoint
+}
+
+// steamReturnURL returns the address Steam sends users back to. The state
+// ties the answer from Steam to the session that asked for it.
+func steamReturnURL(state string) string {
+	return siteURL() + "/steam-callback?state=" + url.QueryEscape(state)
+}
+
+// redirectToSteam sends the user of a request to Steam to sign in, for a
+// given purpose.
+func redirectToSteam(w http.ResponseWriter, r *http.Request, purpose string) {
+	state, err := randomToken()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	session, _ := cookieStore.Get(r, "login")
+	session.Values["steamState"] = state
+	session.Values["steamPurpose"] = purpose
+	err = session.Save(r, w)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Internal server error", 500)
+		return
+	}
+	parameters := url.Values{}
+	parameters.Set("openid.ns", openIDNamespace)
+	parameters.Set("openid.mode", "checkid_setup")
+	parameters.Set("openid.return_to", steamReturnURL(state))
+	parameters.Set("openid.realm", siteURL())
+	parameters.Set("openid.identity", openIDNamespace+"/identifier_select")
+	parameters.Set("openid.claimed_id", openIDNamespace+"/identifier_select")
+	http.Redirect(w, r, steamOpenIDEndpoint()+"?"+parameters.Encode(), http.StatusSeeOther)
+}
+
+// verifySteamCallback checks the answer from Steam in a request to
+// "/steam-callback", and returns the Steam64 ID of the user along with the
+// purpose of their trip to Steam.
+func verifySteamCallback(w http.ResponseWriter, r *http.Request) (steamID int, purpose string, err error) {
+	// The state can only be used once, whatever happens.
+	session, _ := cookieStore.Get(r, "login")
+	state, _ := session.Values["steamState"].(string)
+	purpose, _ = session.Values["steamPurpose"].(string)
+	delete(session.Values, "steamState")
+	delete(session.Values, "steamPurpose")
+	err = session.Save(r, w)
+	if err != nil {
+		return
+	}
+
+	query := r.URL.Query()
+	if state == "" || query.Get("state") != state {
+		err = errors.New("Your sign in through Steam has expired. Please try again.")
+		return
+	}
+	if query.Get("openid.mode") == "cancel" {
+		err = errors.New("You cancelled signing in through Steam.")
+		return
+	}
+	if query.Get("openid.mode") != "id_res" || query.Get("openid.ns") != openIDNamespace ||
+		query.Get("openid.op_endpoint") != steamOpenIDEndpoint() ||
+		query.Get("openid.return_to") != steamReturnURL(state) ||
+		query.Get("openid.claimed_id") != query.Get("openid.identity") {
+		err = errSteamNotVerified
+		return
+	}
+	// Everything we rely on must be covered by the signature.
+	signed := make(map[string]bool)
+	for _, field := range strings.Split(query.Get("openid.signed"), ",") {
+		signed[field] = true
+	}
+	for _, field := range []string{"op_endpoint", "claimed_id", "identity", "return_to", "response_nonce", "assoc_handle"} {
+		if !signed[field] {
+			err = errSteamNotVerified
+			return
+		}
+	}
+	matches := steamClaimedIDRegex.FindStringSubmatch(query.Get("openid.claimed_id"))
+	if matches == nil {
+		err = errSteamNotVerified
+		return
+	}
+	steamID, err = strconv.Atoi(matches[1])
+	if err != nil || steamID < minSteam64 || steamID > maxSteam64 {
+		err = errSteamNotVerified
+		return
+	}
+	err = checkSteamAssertion(query)
+	return
+}
+
+// checkSteamAssertion asks Steam to confirm that it made a given assertion.
+// Steam answers this only once per assertion, so assertions can not be
+// replayed.
+func checkSteamAssertion(query url.Values) error {
+	parameters := url.Values{}
+	for key, values := range query {
+		if strings.HasPrefix(key, "openid.") {
+			parameters[key] = values
+		}
+	}
+	parameters.Set("openid.mode", "check_authentication")
+	client := http.Client{Timeout: 10 * time.Second}
+	response, err := client.PostForm(steamOpenIDEndpoint(), parameters)
+	if err != nil {
+		log.Println("Could not reach Steam: ", err)
+		return errSteamNotVerified
+	}
+	defer response.Body.Close()
+	// The answer is a list of "key:value" lines.
+	scanner := bufio.NewScanner(io.LimitReader(response.Body, 1<<16))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "is_valid:true" {
+			return nil
+		}
+	}
+	return errSteamNotVerified
+}
+
+// steamCallbackHandler handles GET requests to "/steam-callback", where
+// Steam sends users after they have signed in.
+func steamCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	type steamCallbackData struct {
+		LoggedIn bool
+		Linked   bool
+		SteamID  int
+		Error    string
+	}
+	var data steamCallbackData
+	steamID, purpose, err := verifySteamCallback(w, r)
+	if err != nil {
+		data.Error = err.Error()
+		renderContent("tmpl/steamcallback.html", r, w, data)
+		return
+	}
+	data.SteamID = steamID
+	switch purpose {
+	case steamPurposeLogin:
+		user, err := getRunnerBySteam(steamID)
+		if err != nil {
+			data.Error = "No runner has linked this Steam account. Log in with your password, " +
+				"and link your Steam account when editing your profile."
+			break
+		}
+		err = setActiveUser(r, w, user, false)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal server error", 500)
+			return
+		}
+		data.LoggedIn = true
+	case steamPurposeLink:
+		user, err := getActiveUser(r)
+		if err != nil {
+			data.Error = "You must be logged in to link your Steam account."
+			break
+		}
+		err = user.linkSteam(steamID)
+		if err == errSteamAlreadyLinked {
+			data.Error = err.Error()
+			break
+		} else if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal server error", 500)
+			return
+		}
+		data.Linked = true
+	default:
+		data.Error = errSteamNotVerified.Error()
+	}
+	renderContent("tmpl/steamcallback.html", r, w, data)
+}
+
+// steamLinkHandler handles POST requests to "/steam-link", which send
+// logged in runners to Steam to link their Steam account.
+func steamLinkHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := getActiveUser(r)
+	if err != nil || r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+	r.ParseForm()
+	if checkCSRFToken(r) != nil {
+		http.Redirect(w, r, "/edit-profile", http.StatusSeeOther)
+		return
+	}
+	redirectToSteam(w, r, steamPurposeLink)
+}
+
+// steamLoginHandler handles GET requests to "/steam-login", which send
+// users to Steam to sign in.
+func steamLoginHandler(w http.ResponseWriter, r *http.Request) {
+	redirectToSteam(w, r, steamPurposeLogin)
+}
+
+// steamUnlinkHandler handles POST requests to "/steam-unlink".
+func steamUnlinkHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := getActiveUser(r)
+	if err != nil || r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+	r.ParseForm()
+	if checkCSRFToken(r) == nil {
+		err = user.linkSteam(0)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Internal server error", 500)
+			return
+		}
+	}
+	http.Redirect(w, r, "/edit-profile", http.StatusSeeOther)
+}
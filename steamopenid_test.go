@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// A standInSteam is an OpenID provider standing in for Steam. It confirms
+// each assertion it made once, by its nonce, as Steam does.
+type standInSteam struct {
+	server *httptest.Server
+	// invalid makes the provider deny all assertions.
+	invalid bool
+
+	mutex     sync.Mutex
+	confirmed map[string]bool
+	checks    int
+}
+
+func newStandInSteam(t *testing.T) *standInSteam {
+	steam := &standInSteam{confirmed: make(map[string]bool)}
+	steam.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("openid.mode") != "check_authentication" {
+			http.Error(w, "Unexpected request", 400)
+			return
+		}
+		steam.mutex.Lock()
+		defer steam.mutex.Unlock()
+		steam.checks++
+		nonce := r.Form.Get("openid.response_nonce")
+		valid := !steam.invalid && !steam.confirmed[nonce]
+		steam.confirmed[nonce] = true
+		fmt.Fprintf(w, "ns:%s\nis_valid:%t\n", openIDNamespace, valid)
+	}))
+	previousEndpoint, previousSiteURL := config.SteamOpenIDEndpoint, config.SiteURL
+	config.SteamOpenIDEndpoint = steam.server.URL
+	config.SiteURL = "http://mosstier.test"
+	t.Cleanup(func() {
+		steam.server.Close()
+		config.SteamOpenIDEndpoint, config.SiteURL = previousEndpoint, previousSiteURL
+	})
+	return steam
+}
+
+// signIn sends a user to the stand-in, and returns the cookies and the
+// state of their session.
+func (steam *standInSteam) signIn(t *testing.T, purpose string) ([]*http.Cookie, string) {
+	w := httptest.NewRecorder()
+	redirectToSteam(w, httptest.NewRequest("GET", "/steam-login", nil), purpose)
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	returnTo, err := url.Parse(location.Query().Get("openid.return_to"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.Result().Cookies(), returnTo.Query().Get("state")
+}
+
+// assertion returns the answer of the stand-in for a user with a given
+// Steam ID and state.
+func (steam *standInSteam) assertion(steamID int, state string) url.Values {
+	claimedID := fmt.Sprintf("https://steamcommunity.com/openid/id/%d", steamID)
+	return url.Values{
+		"state":                 {state},
+		"openid.ns":             {openIDNamespace},
+		"openid.mode":           {"id_res"},
+		"openid.op_endpoint":    {steam.server.URL},
+		"openid.claimed_id":     {claimedID},
+		"openid.identity":       {claimedID},
+		"openid.return_to":      {steamReturnURL(state)},
+		"openid.response_nonce": {"2016-01-01T00:00:00Z" + state},
+		"openid.assoc_handle":   {"1234567890"},
+		"openid.signed":         {"signed,op_endpoint,claimed_id,identity,return_to,response_nonce,assoc_handle"},
+		"openid.sig":            {"c2lnbmF0dXJl"},
+	}
+}
+
+// callback sends a user back from the stand-in with a given answer.
+func callback(cookies []*http.Cookie, answer url.Values) (int, string, []*http.Cookie, error) {
+	r := httptest.NewRequest("GET", "/steam-callback?"+answer.Encode(), nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	steamID, purpose, err := verifySteamCallback(w, r)
+	return steamID, purpose, w.Result().Cookies(), err
+}
+
+func TestVerifySteamCallback(t *testing.T) {
+	err := initializeCookieStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const steamID = 76561197960265729
+	tests := []struct {
+		name    string
+		invalid bool
+		forge   func(answer url.Values)
+		valid   bool
+	}{
+		{"valid", false, func(url.Values) {}, true},
+		{"forged endpoint", false, func(answer url.Values) {
+			answer.Set("openid.op_endpoint", "https://evil.example/openid/login")
+		}, false},
+		{"unsigned claimed ID", false, func(answer url.Values) {
+			answer.Set("openid.signed", "signed,op_endpoint,identity,return_to,response_nonce,assoc_handle")
+		}, false},
+		{"other Steam ID", false, func(answer url.Values) {
+			answer.Set("openid.identity", "https://steamcommunity.com/openid/id/76561197960265730")
+		}, false},
+		{"invalid assertion", true, func(url.Values) {}, false},
+		{"wrong state", false, func(answer url.Values) {
+			answer.Set("state", "forged")
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			steam := newStandInSteam(t)
+			steam.invalid = test.invalid
+			cookies, state := steam.signIn(t, steamPurposeLink)
+			answer := steam.assertion(steamID, state)
+			test.forge(answer)
+			gotID, purpose, _, err := callback(cookies, answer)
+			if !test.valid {
+				if err == nil {
+					t.Errorf("accepted Steam ID %d", gotID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotID != steamID || purpose != steamPurposeLink {
+				t.Errorf("got Steam ID %d for %q, want %d for %q", gotID, purpose, steamID, steamPurposeLink)
+			}
+		})
+	}
+}
+
+func TestVerifySteamCallbackReplay(t *testing.T) {
+	err := initializeCookieStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	steam := newStandInSteam(t)
+	cookies, state := steam.signIn(t, steamPurposeLogin)
+	answer := steam.assertion(76561197960265729, state)
+	_, _, newCookies, err := callback(cookies, answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The session no longer has the state.
+	_, _, _, err = callback(newCookies, answer)
+	if err == nil {
+		t.Error("accepted an assertion twice in the same session")
+	}
+	// Sessions are stored in cookies, so old ones can be sent again; Steam
+	// then refuses to confirm the assertion a second time.
+	checks := steam.checks
+	_, _, _, err = callback(cookies, answer)
+	if err == nil {
+		t.Error("accepted an assertion twice with an old session")
+	}
+	if steam.checks != checks+1 {
+		t.Error("the replayed assertion was not checked with Steam")
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// A store is a place to persistently store runs and runners. The functions
+// and methods in runs.go and runners.go use the store in `db` for all their
+// storage needs, taking care of everything else (such as hashing passwords
+// and sending mails) themselves.
+type store interface {
+	// getRunsByCategory returns the top `limit` current, unflagged, approved
+	// runs in a given category matching a given filter, best first, and
+	// oldest first among equal results. The runs are not ranked; see
+	// rankRuns. If `limit` is 0, returns all runs.
+	getRunsByCategory(cat category, filter runFilter, limit int64) ([]run, error)
+	// getRunHistoryByCategory returns all unflagged, approved runs in a given
+	// category, including superseded ones, in the order they were approved.
+	getRunHistoryByCategory(cat category) ([]run, error)
+	// getRunsByRunnerID returns all runs, flagged, superseded or not, by a
+	// given runner.
+	getRunsByRunnerID(runnerID int) ([]run, error)
+	// getRunByID returns the run with a given ID.
+	getRunByID(runID int) (run, error)
+	// flag sets the reason for removal of the run with a given ID, clearing
+	// any appeal against an earlier flag.
+	flag(runID int, reason string) error
+	// unflag clears the flag and appeal of the run with a given ID.
+	unflag(runID int) error
+	// appeal stores the runner's explanation of why the flagged run with a
+	// given ID should be unflagged.
+	appeal(runID int, explanation string) error
+	// dismissAppeal marks the appeal of the run with a given ID as seen by
+	// a moderator, keeping the flag.
+	dismissAppeal(runID int) error
+	// getAppealedRuns returns all flagged runs with an appeal that has not
+	// been dismissed, oldest appeal first.
+	getAppealedRuns() ([]run, error)
+	// deleteRun removes the run with a given ID.
+	deleteRun(runID int) error
+	// replaceRun adds a run, setting its ID and time, and supersedes all
+	// current runs by the same runner in the same category. Other pending runs
+	// by the runner in the category are removed. If the run is itself pending,
+	// the current runs are left untouched. If isWorldRecord is true, the run
+	// is also added to the list of new world records.
+	replaceRun(r *run, isWorldRecord bool) error
+	// getPendingRuns returns all unflagged runs waiting for approval,
+	// oldest first.
+	getPendingRuns() ([]run, error)
+	// approveRun makes a pending run appear on the leaderboards, replacing
+	// other runs by the same runner in the same category as replaceRun. If
+	// isWorldRecord is true, the run is added to the list of new world
+	// records.
+	approveRun(r *run, isWorldRecord bool) error
+	// reinstateRun puts an approved run that is not on the leaderboards,
+	// such as an unflagged one, back on them, superseding the current runs
+	// by the same runner in the same category. If isWorldRecord is true, the
+	// run is added to the list of new world records.
+	reinstateRun(r *run, isWorldRecord bool) error
+
+	// getRunnerByID returns the runner with a given ID.
+	getRunnerByID(id int) (runner, error)
+	// getRunnerByUsername returns the runner with a given username.
+	getRunnerByUsername(username string) (runner, error)
+	// getRunnerByUsernameAndEmail returns the runner with a given username
+	// and email.
+	getRunnerByUsernameAndEmail(username, email string) (runner, error)
+	// getRunnerBySteam returns the runner who has verified that they own a
+	// given Steam account.
+	getRunnerBySteam(steamID int) (runner, error)
+	// getWorldRecordSubscribers returns the runners with a verified email
+	// who want to be notified of new world records in main categories if
+	// main is true, and in challenge categories otherwise.
+	getWorldRecordSubscribers(main bool) ([]runner, error)
+	// getStaff returns all moderators and admins, ordered by username.
+	getStaff() ([]runner, error)
+	// setRole sets the role of the runner with a given ID, replacing the
+	// categories they may moderate by the given ones.
+	setRole(runnerID int, role string, categoryIDs []int) error
+	// legacyImported returns true iff the legacy setting with a given name
+	// has been imported into the database.
+	legacyImported(name string) (bool, error)
+	// markLegacyImported records that the legacy setting with a given name
+	// has been imported into the database.
+	markLegacyImported(name string) error
+	// makeUser creates a runner with a given username, email and
+	// already hashed password.
+	makeUser(username, email, hashedPassword string) error
+	// updateRunner stores all fields of the runner but the password. If
+	// hashedPassword is non-empty, the password is updated as well.
+	updateRunner(r *runner, hashedPassword string) error
+	// setSteam links the runner with a given ID to a verified Steam account,
+	// or unlinks their account if steamID is 0. Other runners who have
+	// typed in the same Steam ID lose it.
+	setSteam(runnerID int, steamID int) error
+	// updatePassword sets the hashed password of the runner with a given
+	// username.
+	updatePassword(username, hashedPassword string) error
+	// obsoleteRunsByCategory supersedes all current runs by a given runner
+	// in a given category.
+	obsoleteRunsByCategory(runnerID int, cat category) error
+
+	// createSession stores a login session of a given runner. The ID is
+	// hashed already.
+	createSession(id string, runnerID int, expires time.Time) error
+	// getSession returns the runner and expiry time of the session with a
+	// given hashed ID.
+	getSession(id string) (runnerID int, expires time.Time, err error)
+	// deleteSession ends the session with a given hashed ID.
+	deleteSession(id string) error
+	// deleteSessionsByRunner ends all sessions of a given runner, except the
+	// one with the hashed ID exceptID, if non-empty.
+	deleteSessionsByRunner(runnerID int, exceptID string) error
+	// deleteExpiredSessions removes all sessions that have expired.
+	deleteExpiredSessions() error
+
+	// createPasswordReset stores a password reset link of a given runner.
+	// The ID is hashed already.
+	createPasswordReset(id string, runnerID int, expires time.Time) error
+	// getPasswordReset returns the runner and expiry time of the password
+	// reset link with a given hashed ID.
+	getPasswordReset(id string) (runnerID int, expires time.Time, err error)
+	// deletePasswordResets removes all password reset links of a given
+	// runner, returning how many there were.
+	deletePasswordResets(runnerID int) (deleted int64, err error)
+	// deleteExpiredPasswordResets removes all password reset links that
+	// have expired.
+	deleteExpiredPasswordResets() error
+
+	// createEmailVerification stores a link verifying a given email address
+	// of a given runner. The ID is hashed already.
+	createEmailVerification(id string, runnerID int, email string, expires time.Time) error
+	// getEmailVerification returns the runner, email address, and expiry
+	// time of the email verification link with a given hashed ID.
+	getEmailVerification(id string) (runnerID int, email string, expires time.Time, err error)
+	// verifyEmail marks the email address of a given runner as verified,
+	// provided that it is still the given address.
+	verifyEmail(runnerID int, email string) error
+	// deleteEmailVerifications removes all email verification links of a
+	// given runner.
+	deleteEmailVerifications(runnerID int) error
+	// deleteExpiredEmailVerifications removes all email verification links
+	// that have expired.
+	deleteExpiredEmailVerifications() error
+
+	// saveDaily stores the entries of the daily of a given date, replacing
+	// any entries stored before.
+	saveDaily(date string, leaderboardID int, entries []dailyEntry) error
+	// getDailies returns the latest `limit` dailies, newest first.
+	getDailies(limit int) ([]daily, error)
+	// getDailyEntries returns `limit` entries of the daily of a given date,
+	// skipping the first `offset`, along with the number of entries.
+	getDailyEntries(date string, offset, limit int) (entries []dailyEntry, total int, err error)
+	// getDailyEntriesBySteam returns the latest `limit` daily entries of
+	// a given Steam account, newest first.
+	getDailyEntriesBySteam(steamID int, limit int) ([]dailyEntry, error)
+
+	// addAuditEntry adds an entry to the audit log, setting its time.
+	addAuditEntry(e auditEntry) error
+	// getAuditLog returns the latest `limit` entries of the audit log
+	// matching a given filter, newest first.
+	getAuditLog(filter auditFilter, limit int) ([]auditEntry, error)
+
+	// migrate brings the schema of the store up to date; see migrations.go.
+	migrate() error
+	// printMigrationStatus prints the state of all migrations of the store.
+	printMigrationStatus() error
+	close() error
+}
+
+// openStore opens the store described by a given connection string. Strings
+// of the form "sqlite3:path/to/file.db" give an SQLite store; all others are
+// taken to be MySQL data source names, such as "user:password@/mosstier".
+func openStore(connection string) (store, error) {
+	if strings.HasPrefix(connection, "sqlite3:") {
+		return newSQLiteStore(strings.TrimPrefix(connection, "sqlite3:"))
+	}
+	return newMySQLStore(connection)
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"database/sql"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// newMySQLStore connects to the MySQL database with a given data source
+// name. This is what the live site uses.
+func newMySQLStore(dataSourceName string) (*sqlStore, error) {
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStore{db, mysqlMigrations}, nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"database/sql"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newSQLiteStore opens the SQLite database in a given file, creating it
+// if necessary. This is meant for local development, where setting up a
+// MySQL server is overkill; use ":memory:" for a throwaway database.
+func newSQLiteStore(path string) (*sqlStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows one writer at a time, and every connection to
+	// ":memory:" gets its own database, so we stick to a single connection.
+	db.SetMaxOpenConns(1)
+	return &sqlStore{db, sqliteMigrations}, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+)
+
+// useTestStore replaces `db` by a fresh, migrated in-memory SQLite store for
+// the duration of a test, and reads the data the store relies on.
+func useTestStore(t *testing.T) *sqlStore {
+	readSpelunkerNames()
+	readPlatforms()
+	s, err := newSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := db
+	db = s
+	t.Cleanup(func() {
+		db = previous
+		s.db.Close()
+	})
+	return s
+}
+
+// addTestRunner creates a runner with a given username and returns it.
+func addTestRunner(t *testing.T, username string) runner {
+	err := db.makeUser(username, username+"@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := getRunnerByUsername(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	useTestStore(t)
+	r := addTestRunner(t, "ana")
+	r.Country = "DK"
+	r.Spelunker = spelunkers[3]
+	r.EmailVerified = true
+	r.EmailWr = true
+	err := db.updateRunner(&r, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.setSteam(r.ID, 76561197960265729)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := getRunnerByID(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Username != "ana" || got.Email != "ana@example.com" || got.Country != "DK" ||
+		got.Spelunker != spelunkers[3] || got.Role != roleRunner {
+		t.Errorf("getRunnerByID(%d) = %+v", r.ID, got)
+	}
+	if got, err := getRunnerByUsernameAndEmail("ana", "ana@example.com"); err != nil || got.ID != r.ID {
+		t.Errorf("getRunnerByUsernameAndEmail = %+v, %v", got, err)
+	}
+	if _, err := getRunnerByUsernameAndEmail("ana", "other@example.com"); err == nil {
+		t.Error("getRunnerByUsernameAndEmail found a runner with another email")
+	}
+	if got, err := getRunnerBySteam(76561197960265729); err != nil || got.ID != r.ID {
+		t.Errorf("getRunnerBySteam = %+v, %v", got, err)
+	}
+
+	cat := getMainCategories()[0]
+	subscribers, err := getWorldRecordSubscribers(cat)
+	if err != nil || len(subscribers) != 1 || subscribers[0].ID != r.ID {
+		t.Errorf("getWorldRecordSubscribers = %+v, %v", subscribers, err)
+	}
+
+	submitted := run{
+		Runner:    r,
+		Category:  cat,
+		Score:     123456,
+		Level:     16,
+		Link:      "https://example.com/run",
+		Platform:  platforms[0],
+		Spelunker: spelunkers[3],
+		Comment:   "Nice",
+	}
+	err = db.replaceRun(&submitted, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := getRunByID(submitted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Runner.ID != r.ID || stored.Category.ID != cat.ID || stored.Score != 123456 ||
+		stored.Level != 16 || stored.Link != submitted.Link || stored.Platform != platforms[0] ||
+		stored.Spelunker != spelunkers[3] || stored.Comment != "Nice" || stored.Pending ||
+		!stored.Obsoleted.IsZero() {
+		t.Errorf("getRunByID(%d) = %+v", submitted.ID, stored)
+	}
+	runs, err := db.getRunsByRunnerID(r.ID)
+	if err != nil || len(runs) != 1 || runs[0].ID != submitted.ID {
+		t.Errorf("getRunsByRunnerID = %+v, %v", runs, err)
+	}
+}
@@ -0,0 +1,4 @@
+// Requests that change anything must carry the CSRF token of the page.
+$.ajaxSetup({
+    headers: {"X-CSRF-Token": $('meta[name="csrf-token"]').attr("content")}
+});
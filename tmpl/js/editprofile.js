@@ -1,6 +1,6 @@
 $( document ).ready(function() {
     textAreaCounter();
-    changeEmailwr();
+    $("#challengewrCheckbox")[0].disabled = !$("#newwrCheckbox")[0].checked;
 });
 
 function changeCountry(flag, elementID){
@@ -18,7 +18,7 @@ function changeEmailwr() {
 function textAreaCounter() {
     var currentString = $("textarea").val()
     $("#counter").text(currentString.length);
-    if (currentString.length <= 500)  {
+    if (currentString.length <= 1000)  {
         $("#counter").css("color", "#333");
     } else {
         $("#counter").css("color", "red");
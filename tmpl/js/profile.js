@@ -0,0 +1,18 @@
+function deleteRun(runID) {
+    if (!confirm("Are you sure you want to delete this run?")) {
+        return;
+    }
+    $.ajax({
+        url: "/delete-run",
+        method: "POST",
+        data: {runID: runID},
+        dataType: 'json',
+        success: function(data) {
+            if ("error" in data) {
+                alert(data["error"]);
+            } else {
+                location.reload();
+            }
+        }
+    });
+}
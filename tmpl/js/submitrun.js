@@ -75,9 +75,13 @@ function findResult(runType) {
                 changeSpelunker(spelunker, 'spelunker');
                 $("#inputPlatform").val("1");
             } else {
-                $("#error").show();
+                $("#error").text("Error: " + data["error"]).show();
             }
             $("#working").hide();
+        },
+        error: function() {
+            $("#error").text("Error: Could not reach the server; sorry!").show();
+            $("#working").hide();
         }
     })
 }
\ No newline at end of file
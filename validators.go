@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"regexp"
 )
 
@@ -16,6 +17,22 @@ func isLegitPassword(password string) bool {
 	return password != ""
 }
 
+// maxPasswordLength is the length of the longest password bcrypt can hash
+// in full.
+const maxPasswordLength = 72
+
+// checkPassword returns an error describing why a given new password can
+// not be used, if it can not.
+func checkPassword(password string) error {
+	if !isLegitPassword(password) {
+		return errors.New("Password can not be empty.")
+	}
+	if len(password) > maxPasswordLength {
+		return errors.New("Password can be at most 72 characters long.")
+	}
+	return nil
+}
+
 // isLegitEmailAddress returns true iff the given string looks
 // more or less like an email address.
 func isLegitEmailAddress(address string) bool {
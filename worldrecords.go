@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// worldRecord is a run that held rank 1 in its category at some point.
+type worldRecord struct {
+	Run run
+	// Previous is the world record beaten by the run, if any. Runs that
+	// took over a record whose run was superseded by a worse one did not
+	// beat anything.
+	Previous *run
+	// Set is the time at which the run became the world record.
+	Set time.Time
+	// Superseded is the time at which the run stopped being the world
+	// record, by being beaten or by being superseded by another run by the
+	// same runner. For the current world record, it is the zero time.
+	Superseded time.Time
+}
+
+// getWorldRecordHistory returns all runs that held the world record in a
+// given category, in the order they took it. Rather than relying on newWR,
+// which only knows about records submitted after it was introduced, we
+// replay the leaderboard: runs join it when they are approved and leave it
+// when they are superseded, and the run ranked first on it by rankRuns is
+// the world record, so that ties go to the same run as on the leaderboards.
+func getWorldRecordHistory(cat category) ([]worldRecord, error) {
+	runs, err := getRunHistoryByCategory(cat)
+	if err != nil {
+		return nil, err
+	}
+	var changes []time.Time
+	for _, r := range runs {
+		changes = append(changes, r.approvalTime())
+		if r.IsObsolete() {
+			changes = append(changes, r.Obsoleted)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Before(changes[j]) })
+	var records []worldRecord
+	var current *run
+	for i, t := range changes {
+		if i > 0 && t.Equal(changes[i-1]) {
+			continue
+		}
+		var leaderboard []run
+		for _, r := range runs {
+			if r.approvalTime().After(t) || (r.IsObsolete() && !r.Obsoleted.After(t)) {
+				continue
+			}
+			leaderboard = append(leaderboard, r)
+		}
+		rankRuns(leaderboard, cat)
+		var best *run
+		if len(leaderboard) > 0 {
+			best = &leaderboard[0]
+		}
+		if (best == nil && current == nil) || (best != nil && current != nil && best.ID == current.ID) {
+			continue
+		}
+		if len(records) > 0 && records[len(records)-1].Superseded.IsZero() {
+			records[len(records)-1].Superseded = t
+		}
+		if best != nil {
+			record := worldRecord{Run: *best, Set: t}
+			if current != nil && cat.beats(best.Score, current.Score) {
+				record.Previous = current
+			}
+			records = append(records, record)
+		}
+		current = best
+	}
+	return records, nil
+}
+
+// approvalTime returns the time at which the run appeared on the
+// leaderboards. Runs approved before approvals were recorded have no
+// approval time, and are taken to have appeared when they were submitted.
+func (r *run) approvalTime() time.Time {
+	if r.Approved.IsZero() {
+		return r.Time
+	}
+	return r.Approved
+}
+
+// IsCurrent returns true iff the record is the world record.
+func (wr *worldRecord) IsCurrent() bool {
+	return wr.Superseded.IsZero()
+}
+
+// Standing returns how long the record stood, or has stood so far.
+func (wr *worldRecord) Standing() time.Duration {
+	if wr.IsCurrent() {
+		return time.Since(wr.Set)
+	}
+	return wr.Superseded.Sub(wr.Set)
+}
+
+// FormatSet formats the day on which the run became the world record.
+func (wr *worldRecord) FormatSet() string {
+	return wr.Set.Format("2006-01-02")
+}
+
+// FormatStanding describes how long the record stood in days.
+func (wr *worldRecord) FormatStanding() string {
+	days := int(wr.Standing().Hours() / 24)
+	if days == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", days)
+}
+
+// Margin returns how much the record improved upon the previous one, in
+// dollars or milliseconds. For the first record in a category, it is 0.
+func (wr *worldRecord) Margin() int {
+	if wr.Previous == nil {
+		return 0
+	}
+	if wr.Run.Score > wr.Previous.Score {
+		return wr.Run.Score - wr.Previous.Score
+	}
+	return wr.Previous.Score - wr.Run.Score
+}
+
+// FormatMargin formats the margin like FormatScore formats scores.
+func (wr *worldRecord) FormatMargin() string {
+	if wr.Previous == nil {
+		return ""
+	}
+	margin := run{Category: wr.Run.Category, Score: wr.Margin()}
+	return margin.FormatScore()
+}
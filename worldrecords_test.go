@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// insertTestRun stores an unflagged run with given submission, approval
+// and supersession times, where 0 means none, and returns its ID.
+func insertTestRun(t *testing.T, s *sqlStore, runnerID int, cat category, score int, date, approved, obsoleted int64) int {
+	pending := approved == 0
+	result, err := s.db.Exec("INSERT INTO runs (runner, cat, score, level, link, platform, spelunker, date, comment, flag, pending, approved, obsoleted) VALUES (?, ?, ?, 1, '', 1, 0, ?, '', '', ?, ?, ?)",
+		runnerID, cat.ID, score, date, pending, approved, obsoleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(id)
+}
+
+// execTestSQL runs a statement against the test store.
+func execTestSQL(t *testing.T, s *sqlStore, query string, args ...interface{}) {
+	_, err := s.db.Exec(query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectedRecord describes a record by the IDs of its run and the run it
+// beat, and the times it was set and superseded, where 0 means none.
+type expectedRecord struct {
+	runID      int
+	previousID int
+	set        int64
+	superseded int64
+}
+
+func checkWorldRecordHistory(t *testing.T, cat category, want []expectedRecord) {
+	records, err := getWorldRecordHistory(cat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d: %+v", len(records), len(want), records)
+	}
+	for i, w := range want {
+		got := records[i]
+		if got.Run.ID != w.runID {
+			t.Errorf("record %d is run %d, want %d", i, got.Run.ID, w.runID)
+		}
+		previousID := 0
+		if got.Previous != nil {
+			previousID = got.Previous.ID
+		}
+		if previousID != w.previousID {
+			t.Errorf("record %d beat run %d, want %d", i, previousID, w.previousID)
+		}
+		if !got.Set.Equal(time.Unix(w.set, 0)) {
+			t.Errorf("record %d was set at %v, want %d", i, got.Set.Unix(), w.set)
+		}
+		if w.superseded == 0 {
+			if !got.IsCurrent() {
+				t.Errorf("record %d was superseded at %v, want current", i, got.Superseded.Unix())
+			}
+		} else if got.IsCurrent() || got.Superseded.Unix() != w.superseded {
+			t.Errorf("record %d was superseded at %v, want %d", i, got.Superseded.Unix(), w.superseded)
+		}
+	}
+}
+
+func TestWorldRecordHistory(t *testing.T) {
+	s := useTestStore(t)
+	cat, err := getCategoryByAbbr("score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ana := addTestRunner(t, "ana")
+	bob := addTestRunner(t, "bob")
+	cid := addTestRunner(t, "cid")
+
+	// Ana sets the first record, and bob submits a worse run.
+	ana1 := insertTestRun(t, s, ana.ID, cat, 1000, 100, 100, 300)
+	bob1 := insertTestRun(t, s, bob.ID, cat, 900, 200, 200, 0)
+	// Ana replaces their record by a worse run, which hands the record to bob.
+	insertTestRun(t, s, ana.ID, cat, 500, 300, 300, 0)
+	// Cid beats bob, but the run is only approved later; a run approved in
+	// the meantime that beats bob is the record until then.
+	cid1 := insertTestRun(t, s, cid.ID, cat, 2000, 400, 600, 0)
+	bob2 := insertTestRun(t, s, bob.ID, cat, 1500, 500, 500, 0)
+	execTestSQL(t, s, "UPDATE runs SET obsoleted = 500 WHERE id = ?", bob1)
+	// Flagged and pending runs never hold the record.
+	insertTestRun(t, s, ana.ID, cat, 9000, 700, 0, 0)
+	flagged := insertTestRun(t, s, bob.ID, cat, 9000, 800, 800, 0)
+	execTestSQL(t, s, "UPDATE runs SET flag = 'Fake' WHERE id = ?", flagged)
+
+	checkWorldRecordHistory(t, cat, []expectedRecord{
+		{ana1, 0, 100, 300},
+		{bob1, 0, 300, 500},
+		{bob2, bob1, 500, 600},
+		{cid1, bob2, 600, 0},
+	})
+}
+
+func TestWorldRecordHistoryTie(t *testing.T) {
+	s := useTestStore(t)
+	cat, err := getCategoryByAbbr("score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ana := addTestRunner(t, "ana")
+	bob := addTestRunner(t, "bob")
+
+	// Ana submits first, but bob's equal run is approved first. Once ana's
+	// run is approved, it wins the tie, as on the leaderboards.
+	ana1 := insertTestRun(t, s, ana.ID, cat, 1000, 100, 300, 0)
+	bob1 := insertTestRun(t, s, bob.ID, cat, 1000, 200, 200, 0)
+	checkWorldRecordHistory(t, cat, []expectedRecord{
+		{bob1, 0, 200, 300},
+		{ana1, 0, 300, 0},
+	})
+	records, err := getAllWorldRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records[0].ID != ana1 {
+		t.Errorf("the current record is run %d, want %d", records[0].ID, ana1)
+	}
+}